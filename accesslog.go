@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// accessLogFields are the fields request_log_fields can select. status
+// falls back to the error's code, or 500, when the handler returned an
+// error that the error handler has not written yet.
+var accessLogFields = map[string]func(c fiber.Ctx, start time.Time, err error) any{
+	"method":        func(c fiber.Ctx, _ time.Time, _ error) any { return c.Method() },
+	"path":          func(c fiber.Ctx, _ time.Time, _ error) any { return c.Path() },
+	"status":        func(c fiber.Ctx, _ time.Time, err error) any { return accessLogStatus(c, err) },
+	"duration":      func(_ fiber.Ctx, start time.Time, _ error) any { return sinceMillis(start) },
+	"ip":            func(c fiber.Ctx, _ time.Time, _ error) any { return c.IP() },
+	"bytes":         func(c fiber.Ctx, _ time.Time, _ error) any { return len(c.Response().Body()) },
+	"matched_route": func(c fiber.Ctx, _ time.Time, _ error) any { return c.Route().Path },
+}
+
+func validateAccessLog(fields []string) error {
+	for _, name := range fields {
+		if _, ok := accessLogFields[name]; !ok {
+			return fmt.Errorf("unsupported request_log_fields entry %q (use %s)", name, accessLogFieldNames())
+		}
+	}
+	return nil
+}
+
+// accessLog logs one "request" line per webhook request with the chosen
+// fields, in the order listed.
+func accessLog(fields []string, logger *slog.Logger) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		attrs := make([]any, 0, 2*len(fields))
+		for _, name := range fields {
+			attrs = append(attrs, name, accessLogFields[name](c, start, err))
+		}
+		logger.Info("request", attrs...)
+		return err
+	}
+}
+
+func accessLogStatus(c fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	if fe := new(fiber.Error); errors.As(err, &fe) {
+		return fe.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+func sinceMillis(start time.Time) float64 {
+	return float64(time.Since(start)) / float64(time.Millisecond)
+}
+
+func accessLogFieldNames() string {
+	names := make([]string, 0, len(accessLogFields))
+	for name := range accessLogFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
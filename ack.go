@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type AckFormat string
+
+const (
+	AckFormatJSON AckFormat = "json"
+	AckFormatXML  AckFormat = "xml"
+)
+
+// waitAckDelay sleeps for delay plus a random extra in [0, jitter] before
+// the ack is sent. It returns early if ctx is cancelled, which for a
+// fasthttp request context happens when the server shuts down.
+func waitAckDelay(ctx context.Context, delay, jitter time.Duration) {
+	d := delay
+	if jitter > 0 {
+		d += rand.N(jitter + 1)
+	}
+	if d <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// sendAck writes the ack body as JSON, or as XML when ack_xml is enabled
+// and the Accept header prefers XML. Without a usable Accept header the
+// ack_default_format is used.
+func sendAck(c fiber.Ctx, cfg Config, body any) error {
+	c.Status(cfg.AckStatus)
+	if !cfg.AckXML {
+		return c.JSON(body)
+	}
+
+	offers := []string{fiber.MIMEApplicationJSON, fiber.MIMEApplicationXML, fiber.MIMETextXML}
+	if cfg.AckDefaultFormat == AckFormatXML {
+		offers = []string{fiber.MIMEApplicationXML, fiber.MIMETextXML, fiber.MIMEApplicationJSON}
+	}
+	switch c.Accepts(offers...) {
+	case fiber.MIMEApplicationXML, fiber.MIMETextXML:
+		data, err := marshalAckXML(body)
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+		return c.Send(data)
+	default:
+		return c.JSON(body)
+	}
+}
+
+// marshalAckXML encodes value as XML under an <ack> root. Object keys
+// become elements in sorted order, array elements become repeated <item>
+// elements, and characters that are not valid in element names are
+// replaced with '_'. The value is first round-tripped through JSON, so
+// typed maps and slices from the mappings, such as headers and query,
+// encode the same way as decoded JSON.
+func marshalAckXML(value any) ([]byte, error) {
+	value, err := normalizeJSONValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := encodeXMLValue(enc, "ack", value); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// normalizeJSONValue returns value as encoding/json would decode it, with
+// numbers kept as json.Number so they print as they were written.
+func normalizeJSONValue(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var normalized any
+	if err := dec.Decode(&normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+func encodeXMLValue(enc *xml.Encoder, name string, value any) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlElementName(name)}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encodeXMLValue(enc, k, v[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := encodeXMLValue(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+func xmlElementName(name string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	if cleaned == "" || !(cleaned[0] == '_' || (cleaned[0] >= 'a' && cleaned[0] <= 'z') || (cleaned[0] >= 'A' && cleaned[0] <= 'Z')) {
+		cleaned = "_" + cleaned
+	}
+	return cleaned
+}
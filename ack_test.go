@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMarshalAckXMLDefaultMappings(t *testing.T) {
+	cfg := defaultConfig()
+	decode, err := newBodyDecoder(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.Header.SetMethod(fiber.MethodPost)
+	fctx.Request.SetRequestURI("/hooks?ref=main&n=1")
+	fctx.Request.Header.Set("X-Event", "push")
+	fctx.Request.SetBody([]byte(`{"id":1234,"tags":["a","b"]}`))
+	app := fiber.New()
+	c := app.AcquireCtx(fctx)
+	defer app.ReleaseCtx(c)
+
+	output, err := buildOutput(c, newRequestBody(c, decode), cfg.Mappings, cfg.RootMergeStrategy)
+	if err != nil {
+		t.Fatalf("buildOutput() error = %v", err)
+	}
+	data, err := marshalAckXML(output)
+	if err != nil {
+		t.Fatalf("marshalAckXML() error = %v", err)
+	}
+
+	got := string(data)
+	for _, want := range []string{
+		// headers is a map[string][]string and query a map[string]string;
+		// both must come out as elements rather than Go's map syntax.
+		"<headers>",
+		"<X-Event><item>push</item></X-Event>",
+		"<query><n>1</n><ref>main</ref></query>",
+		"<body><id>1234</id><tags><item>a</item><item>b</item></tags></body>",
+		"<method>POST</method>",
+		"<path>/hooks</path>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("marshalAckXML() = %s, want it to contain %s", got, want)
+		}
+	}
+	if strings.Contains(got, "map[") {
+		t.Errorf("marshalAckXML() = %s, Go map syntax leaked into the XML", got)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// asyncOutput writes output after the ack has been sent, for ack_first
+// routes, so providers that want a fast response are not held up by a
+// slow sink. Wait blocks until pending writes finish, so shutdown does not
+// lose them.
+type asyncOutput struct {
+	sink   outputSink
+	dead   *deadLetter
+	logger *slog.Logger
+	wg     sync.WaitGroup
+}
+
+// write writes lines in the background. keys holds the partition key of
+// each line, or is nil when output is not partitioned. letter is the
+// request's dead-letter record, captured while the request was still
+// valid; it is written with the error if the sink fails, since the sender
+// has already been told the request succeeded.
+func (a *asyncOutput) write(lines [][]byte, keys []string, letter map[string]any, requestID string) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		for i, line := range lines {
+			key := ""
+			if keys != nil {
+				key = keys[i]
+			}
+			err := writeOutputLine(a.sink, line, key, letter)
+			if err == nil {
+				continue
+			}
+			a.logger.Error("failed to write output after ack", "error", err, "request_id", requestID)
+			if letter != nil {
+				letter["error"] = err.Error()
+				if err := a.dead.writeRecord(letter); err != nil {
+					a.logger.Error("failed to write dead letter", "error", err, "request_id", requestID)
+				}
+			}
+			return
+		}
+	}()
+}
+
+func (a *asyncOutput) Wait() {
+	a.wg.Wait()
+}
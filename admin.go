@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type AdminConfig struct {
+	Token string `json:"token" yaml:"token"`
+}
+
+type RecentConfig struct {
+	Size int    `json:"size" yaml:"size"`
+	Path string `json:"path" yaml:"path"`
+}
+
+// ConfigEndpointConfig serves the effective config, with secrets masked,
+// at an admin endpoint.
+type ConfigEndpointConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Path    string `json:"path" yaml:"path"`
+}
+
+const maskedSecret = "********"
+
+// maskedConfig returns cfg with every secret replaced by a placeholder.
+// Unset secrets stay empty so it is still visible which are configured.
+// New secret fields must be added here.
+func maskedConfig(cfg Config) Config {
+	for _, secret := range []*string{
+		&cfg.MetaVerify.VerifyToken,
+		&cfg.SlackVerify.SigningSecret,
+		&cfg.GitHubVerify.Secret,
+		&cfg.JWT.Secret,
+		&cfg.Output.Auth.Password,
+		&cfg.Output.Auth.APIKey,
+		&cfg.Admin.Token,
+	} {
+		if *secret != "" {
+			*secret = maskedSecret
+		}
+	}
+
+	// Routes are copied so masking leaves the live config alone.
+	cfg.Routes = slices.Clone(cfg.Routes)
+	for i := range cfg.Routes {
+		maskRouteSecrets(&cfg.Routes[i])
+	}
+	maskRouteSecrets(&cfg.ProviderRoute)
+	cfg.Providers = slices.Clone(cfg.Providers)
+	for i := range cfg.Providers {
+		maskRouteSecrets(&cfg.Providers[i].RouteConfig)
+	}
+	return cfg
+}
+
+// requireAdminToken guards admin endpoints with a bearer token, answering
+// failed checks with rejection.
+func requireAdminToken(token string, rejection RejectionResponse, logger *slog.Logger) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		provided, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			return rejection.reject(c, logger, "admin auth", nil)
+		}
+		return c.Next()
+	}
+}
+
+// recentBuffer keeps the last size output records in memory.
+type recentBuffer struct {
+	mu      sync.Mutex
+	records []any
+	next    int
+	full    bool
+}
+
+func newRecentBuffer(size int) *recentBuffer {
+	return &recentBuffer{records: make([]any, size)}
+}
+
+func (b *recentBuffer) Add(record any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.records[b.next] = record
+	b.next = (b.next + 1) % len(b.records)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Snapshot returns the buffered records from oldest to newest.
+func (b *recentBuffer) Snapshot() []any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append([]any{}, b.records[:b.next]...)
+	}
+	return append(append([]any{}, b.records[b.next:]...), b.records[:b.next]...)
+}
@@ -0,0 +1,31 @@
+package main
+
+// batchBodies splits a batched request into one body per element of the
+// array at path, so each element goes through the mappings as if it had
+// been sent on its own. Every element keeps the raw bytes of the whole
+// request. When path is empty, the body is not JSON, or path does not
+// lead to an array, the request is handled as a single body and batched
+// is false.
+func batchBodies(body *requestBody, path string) (bodies []*requestBody, batched bool) {
+	if path == "" {
+		return []*requestBody{body}, false
+	}
+	body.parse()
+	if body.parseErr != nil {
+		return []*requestBody{body}, false
+	}
+	value, ok := lookupPath(body.parsed, path)
+	if !ok {
+		return []*requestBody{body}, false
+	}
+	items, ok := value.([]any)
+	if !ok {
+		return []*requestBody{body}, false
+	}
+
+	bodies = make([]*requestBody, len(items))
+	for i, item := range items {
+		bodies[i] = &requestBody{raw: body.raw, decode: body.decode, parsed: item, isParsed: true}
+	}
+	return bodies, true
+}
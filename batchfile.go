@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// batchFileSink writes records into one JSON array file per time window.
+// A window's file is created on its first record and finalized with a
+// closing bracket when the window ends or the sink is closed, so every
+// finished file is a valid JSON document.
+type batchFileSink struct {
+	mu        sync.Mutex
+	dir       string
+	window    time.Duration
+	file      *os.File
+	windowEnd time.Time
+	count     int
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newBatchFileSink(dir string, window time.Duration) (*batchFileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create batch dir: %w", err)
+	}
+
+	s := &batchFileSink{
+		dir:    dir,
+		window: window,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.rotateLoop()
+	return s, nil
+}
+
+// Preflight checks that the batch directory is writable.
+func (s *batchFileSink) Preflight() error {
+	if err := checkDirWritable(s.dir); err != nil {
+		return fmt.Errorf("batch dir: %w", err)
+	}
+	return nil
+}
+
+// rotateLoop finalizes the current file at each window boundary, even
+// when no further records arrive.
+func (s *batchFileSink) rotateLoop() {
+	defer close(s.done)
+
+	for {
+		next := time.Now().Truncate(s.window).Add(s.window)
+		select {
+		case <-time.After(time.Until(next)):
+			s.mu.Lock()
+			if s.file != nil && !time.Now().Before(s.windowEnd) {
+				_ = s.closeFile()
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *batchFileSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.file != nil && !now.Before(s.windowEnd) {
+		if err := s.closeFile(); err != nil {
+			return err
+		}
+	}
+	if s.file == nil {
+		if err := s.openFile(now); err != nil {
+			return err
+		}
+	}
+
+	sep := ",\n"
+	if s.count == 0 {
+		sep = "[\n"
+	}
+	if _, err := s.file.WriteString(sep); err != nil {
+		return err
+	}
+	if _, err := s.file.Write(bytes.TrimRight(line, "\n")); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
+
+func (s *batchFileSink) openFile(now time.Time) error {
+	start := now.Truncate(s.window)
+	base := start.UTC().Format("20060102T150405Z")
+
+	// A restart within the same window must not append to a finished
+	// array, so pick the first unused name.
+	for i := 0; ; i++ {
+		name := base + ".json"
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d.json", base, i)
+		}
+		f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("open batch file: %w", err)
+		}
+		s.file = f
+		s.windowEnd = start.Add(s.window)
+		s.count = 0
+		return nil
+	}
+}
+
+func (s *batchFileSink) closeFile() error {
+	_, err := s.file.WriteString("\n]\n")
+	err = errors.Join(err, s.file.Close())
+	s.file = nil
+	return err
+}
+
+func (s *batchFileSink) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.closeFile()
+}
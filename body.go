@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/gofiber/fiber/v3"
+)
+
+// requestBody captures the request body once at handler entry so that
+// every consumer (body mappings, signature checks, forwarding) sees the
+// same bytes without re-reading or re-decoding the request. Fiber decodes
+// Content-Encoding on each Body call, so reading it once also avoids
+// repeated decompression.
+type requestBody struct {
+	raw      []byte
+	decode   bodyDecoder
+	parsed   any
+	parseErr error
+	isParsed bool
+}
+
+func newRequestBody(c fiber.Ctx, decode bodyDecoder) *requestBody {
+	return &requestBody{raw: c.Body(), decode: decode}
+}
+
+// Raw returns the captured body bytes. They are only valid for the
+// lifetime of the request.
+func (b *requestBody) Raw() []byte {
+	return b.raw
+}
+
+// Parsed returns the decoded body, parsing it on first use. Each call gets
+// an independent copy so per-mapping options that edit the value in place
+// cannot affect other mappings.
+func (b *requestBody) Parsed() (any, error) {
+	b.parse()
+	if b.parseErr != nil {
+		return nil, b.parseErr
+	}
+	return cloneJSON(b.parsed), nil
+}
+
+// parse decodes the body if it has not been decoded yet.
+func (b *requestBody) parse() {
+	if !b.isParsed {
+		b.parsed, b.parseErr = b.decode(b.raw)
+		b.isParsed = true
+	}
+}
+
+// cloneJSON deep-copies decoded JSON objects and arrays.
+func cloneJSON(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		cp := make(map[string]any, len(v))
+		for k, item := range v {
+			cp[k] = cloneJSON(item)
+		}
+		return cp
+	case []any:
+		cp := make([]any, len(v))
+		for i, item := range v {
+			cp[i] = cloneJSON(item)
+		}
+		return cp
+	default:
+		return value
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// UnknownKeysPolicy decides what happens to top-level body keys that are
+// not in allowed_body_keys.
+type UnknownKeysPolicy string
+
+const (
+	UnknownKeysAllow  UnknownKeysPolicy = "allow"
+	UnknownKeysReject UnknownKeysPolicy = "reject"
+	UnknownKeysDrop   UnknownKeysPolicy = "drop"
+)
+
+func validateBodyKeys(cfg Config) error {
+	switch cfg.UnknownKeys {
+	case UnknownKeysAllow:
+	case UnknownKeysReject, UnknownKeysDrop:
+		if len(cfg.AllowedBodyKeys) == 0 {
+			return fmt.Errorf("unknown_keys %q requires allowed_body_keys", cfg.UnknownKeys)
+		}
+	default:
+		return fmt.Errorf("unsupported unknown_keys %q (use allow, reject, or drop)", cfg.UnknownKeys)
+	}
+	return nil
+}
+
+// checkBodyKeys applies the unknown_keys policy to a JSON object body. It
+// works on the parsed body itself, so dropped keys are gone for every
+// mapping. Bodies that are not objects are left alone.
+func checkBodyKeys(body *requestBody, allowed []string, policy UnknownKeysPolicy) error {
+	if policy == UnknownKeysAllow {
+		return nil
+	}
+	body.parse()
+	obj, ok := body.parsed.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	var unknown []string
+	for k := range obj {
+		if !slices.Contains(allowed, k) {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	if policy == UnknownKeysDrop {
+		for _, k := range unknown {
+			delete(obj, k)
+		}
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unexpected body keys: %s", strings.Join(unknown, ", "))
+}
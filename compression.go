@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+)
+
+type CompressionConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Level   string `json:"level" yaml:"level"`
+	MinSize int    `json:"min_size" yaml:"min_size"`
+}
+
+func validateCompression(cfg CompressionConfig) error {
+	if _, _, err := compressionLevels(cfg.Level); err != nil {
+		return err
+	}
+	if cfg.MinSize < 0 {
+		return fmt.Errorf("compression.min_size must not be negative")
+	}
+	return nil
+}
+
+func compressionLevels(level string) (brotli int, gzip int, err error) {
+	switch level {
+	case "", "default":
+		return fasthttp.CompressBrotliDefaultCompression, fasthttp.CompressDefaultCompression, nil
+	case "best_speed":
+		return fasthttp.CompressBrotliBestSpeed, fasthttp.CompressBestSpeed, nil
+	case "best_compression":
+		return fasthttp.CompressBrotliBestCompression, fasthttp.CompressBestCompression, nil
+	default:
+		return 0, 0, fmt.Errorf("unsupported compression.level %q (use default, best_speed, or best_compression)", level)
+	}
+}
+
+// newAckCompression compresses the ack response when the caller sends
+// Accept-Encoding and the body is at least MinSize bytes. It uses the same
+// fasthttp compressor as Fiber's compress middleware, which has no size
+// threshold of its own.
+func newAckCompression(cfg CompressionConfig) fiber.Handler {
+	brotliLevel, gzipLevel, _ := compressionLevels(cfg.Level)
+	compressor := fasthttp.CompressHandlerBrotliLevel(func(*fasthttp.RequestCtx) {}, brotliLevel, gzipLevel)
+
+	return func(c fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		c.Vary(fiber.HeaderAcceptEncoding)
+		if c.Method() == fiber.MethodHead ||
+			c.Response().StatusCode() == fiber.StatusNoContent ||
+			len(c.Response().Body()) < cfg.MinSize ||
+			c.GetRespHeader(fiber.HeaderContentEncoding) != "" {
+			return nil
+		}
+
+		compressor(c.RequestCtx())
+		return nil
+	}
+}
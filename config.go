@@ -4,13 +4,48 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Duration is a time.Duration written as a string such as "500ms" or "1m"
+// in both YAML and JSON config files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	return d.set(s)
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1s\": %w", err)
+	}
+	return d.set(s)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
 func loadConfig(path string) (Config, error) {
 	cfg := defaultConfig()
 
@@ -36,49 +71,402 @@ func loadConfig(path string) (Config, error) {
 		return Config{}, fmt.Errorf("unsupported config extension %q (use .yaml, .yml, or .json)", ext)
 	}
 
+	clearDefaultMappings(&cfg)
 	if cfg.AckBody == nil {
 		cfg.AckBody = map[string]any{"ok": true}
 	}
+	if cfg.RootMergeStrategy == "" {
+		cfg.RootMergeStrategy = RootMergeError
+	}
+	if cfg.KeyCase == "" {
+		cfg.KeyCase = KeyCaseAsIs
+	}
+	if cfg.MetaVerify.VerifyToken, err = resolveSecret(cfg.MetaVerify.VerifyToken); err != nil {
+		return Config{}, fmt.Errorf("meta_verify.verify_token: %w", err)
+	}
+	if cfg.SlackVerify.SigningSecret, err = resolveSecret(cfg.SlackVerify.SigningSecret); err != nil {
+		return Config{}, fmt.Errorf("slack_verify.signing_secret: %w", err)
+	}
+	if cfg.GitHubVerify.Secret, err = resolveSecret(cfg.GitHubVerify.Secret); err != nil {
+		return Config{}, fmt.Errorf("github_verify.secret: %w", err)
+	}
+	for i := range cfg.Routes {
+		if err := resolveRouteSecrets(&cfg.Routes[i], fmt.Sprintf("routes[%d]", i)); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := resolveRouteSecrets(&cfg.ProviderRoute, "provider_route"); err != nil {
+		return Config{}, err
+	}
+	for i := range cfg.Providers {
+		if err := resolveRouteSecrets(&cfg.Providers[i].RouteConfig, fmt.Sprintf("providers[%d]", i)); err != nil {
+			return Config{}, err
+		}
+	}
+	if cfg.JWT.Secret, err = resolveSecret(cfg.JWT.Secret); err != nil {
+		return Config{}, fmt.Errorf("jwt.secret: %w", err)
+	}
+	if cfg.JWT.PublicKey, err = resolveSecret(cfg.JWT.PublicKey); err != nil {
+		return Config{}, fmt.Errorf("jwt.public_key: %w", err)
+	}
+	if cfg.JWT.PublicKey != "" {
+		if cfg.JWT.publicKey, err = parseJWTPublicKey(cfg.JWT.PublicKey); err != nil {
+			return Config{}, fmt.Errorf("jwt.public_key: %w", err)
+		}
+	}
+	if cfg.Output.Auth.Password, err = resolveSecret(cfg.Output.Auth.Password); err != nil {
+		return Config{}, fmt.Errorf("output.auth.password: %w", err)
+	}
+	if cfg.Output.Auth.APIKey, err = resolveSecret(cfg.Output.Auth.APIKey); err != nil {
+		return Config{}, fmt.Errorf("output.auth.api_key: %w", err)
+	}
+	if cfg.Admin.Token, err = resolveSecret(cfg.Admin.Token); err != nil {
+		return Config{}, fmt.Errorf("admin.token: %w", err)
+	}
 
 	return cfg, nil
 }
 
+// resolveSecret expands secret values written as "env:NAME" or
+// "file:/path" so secrets can stay out of the config file. Other values
+// are returned unchanged.
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, "file:"):
+		path := strings.TrimPrefix(value, "file:")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return value, nil
+	}
+}
+
 func validateConfig(cfg Config) error {
 	if cfg.Port <= 0 || cfg.Port > 65535 {
 		return fmt.Errorf("port must be in range 1-65535")
 	}
+	if cfg.BindAddress != "" && net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(cfg.BindAddress, "["), "]")) == nil {
+		return fmt.Errorf("bind_address must be an IPv4 or IPv6 address")
+	}
 	if cfg.Route == "" || !strings.HasPrefix(cfg.Route, "/") {
 		return fmt.Errorf("route must start with '/'")
 	}
-	if len(cfg.Mappings) == 0 {
+	if cfg.BasePath != "" && !strings.HasPrefix(cfg.BasePath, "/") {
+		return fmt.Errorf("base_path must start with '/'")
+	}
+	if len(cfg.Mappings) == 0 && !cfg.Passthrough {
 		return fmt.Errorf("at least one mapping is required")
 	}
 
-	seen := map[string]struct{}{}
-	for i, m := range cfg.Mappings {
-		if m.From == "" {
-			return fmt.Errorf("mappings[%d].from is required", i)
+	switch cfg.KeyCase {
+	case KeyCaseAsIs, KeyCaseLower, KeyCaseSnake:
+	default:
+		return fmt.Errorf("unsupported key_case %q (use as_is, lower, or snake)", cfg.KeyCase)
+	}
+
+	if err := validateMappings("mappings", cfg.Mappings, cfg.KeyCase); err != nil {
+		return err
+	}
+	if err := validateRoutes(cfg); err != nil {
+		return err
+	}
+
+	if cfg.AckDelay < 0 {
+		return fmt.Errorf("ack_delay must not be negative")
+	}
+	if cfg.AckDelayJitter < 0 {
+		return fmt.Errorf("ack_delay_jitter must not be negative")
+	}
+	if cfg.RequestIDHeader == "" {
+		return fmt.Errorf("request_id_header is required")
+	}
+	if cfg.AckStatus < 100 || cfg.AckStatus > 599 {
+		return fmt.Errorf("ack_status must be a valid HTTP status code")
+	}
+	switch cfg.AckDefaultFormat {
+	case AckFormatJSON:
+	case AckFormatXML:
+		if !cfg.AckXML {
+			return fmt.Errorf("ack_default_format %q requires ack_xml", AckFormatXML)
+		}
+	default:
+		return fmt.Errorf("unsupported ack_default_format %q (use json or xml)", cfg.AckDefaultFormat)
+	}
+	if _, err := parseLogLevel(cfg.LogLevel); err != nil {
+		return err
+	}
+	for i, rule := range cfg.Echo {
+		if rule.From != SourceHeaders && rule.From != SourceQuery {
+			return fmt.Errorf("echo[%d].from must be %q or %q", i, SourceHeaders, SourceQuery)
+		}
+		if rule.Name == "" {
+			return fmt.Errorf("echo[%d].name is required", i)
+		}
+		if rule.Header == "" {
+			return fmt.Errorf("echo[%d].header is required", i)
+		}
+	}
+	if cfg.Explode != "" {
+		if err := validatePath(cfg.Explode); err != nil {
+			return fmt.Errorf("explode: %w", err)
+		}
+	}
+	if cfg.BatchPath != "" {
+		if err := validatePath(cfg.BatchPath); err != nil {
+			return fmt.Errorf("batch_path: %w", err)
+		}
+	}
+	if len(cfg.OutputMeta) > 0 && cfg.OutputWrapper == "" && !cfg.Envelope.Enabled {
+		return fmt.Errorf("output_meta requires output_wrapper or envelope")
+	}
+	if _, err := compileRedactPatterns(cfg.RedactPatterns); err != nil {
+		return err
+	}
+	if cfg.MaxStringLen < 0 {
+		return fmt.Errorf("max_string_len must not be negative")
+	}
+	if err := validateEnvelope(cfg); err != nil {
+		return err
+	}
+	if _, ok := cfg.OutputMeta[cfg.OutputWrapper]; ok {
+		return fmt.Errorf("output_meta key %q collides with output_wrapper", cfg.OutputWrapper)
+	}
+	if cfg.MaxJSONDepth < 0 {
+		return fmt.Errorf("max_json_depth must not be negative")
+	}
+	if cfg.MaxHeaders < 0 || cfg.MaxQueryParams < 0 {
+		return fmt.Errorf("max_headers and max_query_params must not be negative")
+	}
+	switch cfg.BodyHashAlgorithm {
+	case HashSHA256, HashSHA1, HashMD5:
+	default:
+		return fmt.Errorf("unsupported body_hash_algorithm %q (use sha256, sha1, or md5)", cfg.BodyHashAlgorithm)
+	}
+	switch cfg.OnKeyCollision {
+	case KeyCollisionError, KeyCollisionFirst, KeyCollisionLast:
+	default:
+		return fmt.Errorf("unsupported on_key_collision %q (use error, first, or last)", cfg.OnKeyCollision)
+	}
+	switch cfg.OnLimitExceeded {
+	case LimitTruncate, LimitReject:
+	default:
+		return fmt.Errorf("unsupported on_limit_exceeded %q (use truncate or reject)", cfg.OnLimitExceeded)
+	}
+	switch cfg.OnEmptyOutput {
+	case EmptyOutputEmit, EmptyOutputSkip, EmptyOutputError:
+	default:
+		return fmt.Errorf("unsupported on_empty_output %q (use emit, skip, or error)", cfg.OnEmptyOutput)
+	}
+	switch cfg.NonUTF8Policy {
+	case NonUTF8Base64, NonUTF8Replace, NonUTF8Error:
+	default:
+		return fmt.Errorf("unsupported non_utf8_policy %q (use base64, replace, or error)", cfg.NonUTF8Policy)
+	}
+	switch cfg.OutputPrefixMode {
+	case OutputPrefixText:
+		if cfg.OutputPrefix != "" && cfg.Output.Format == OutputFormatMsgpack {
+			return fmt.Errorf("output_prefix_mode %q is not supported with output.format %q (use field)", OutputPrefixText, OutputFormatMsgpack)
+		}
+		if cfg.OutputPrefix != "" && cfg.Output.Mode != OutputStdout && cfg.Output.Mode != OutputExec {
+			return fmt.Errorf("output_prefix_mode %q is not supported with output.mode %q (use field)", OutputPrefixText, cfg.Output.Mode)
+		}
+	case OutputPrefixField:
+		if cfg.OutputPrefix != "" && cfg.OutputPrefixField == "" {
+			return fmt.Errorf("output_prefix_field is required when output_prefix_mode is %q", OutputPrefixField)
+		}
+	default:
+		return fmt.Errorf("unsupported output_prefix_mode %q (use text or field)", cfg.OutputPrefixMode)
+	}
+	if cfg.SlackVerify.SigningSecret != "" && cfg.SlackVerify.Tolerance <= 0 {
+		return fmt.Errorf("slack_verify.tolerance must be positive")
+	}
+	if cfg.JWT.Header == "" {
+		return fmt.Errorf("jwt.header is required")
+	}
+	if cfg.JWT.Secret != "" && cfg.JWT.PublicKey != "" {
+		return fmt.Errorf("jwt.secret and jwt.public_key cannot both be set")
+	}
+	if err := validateBodyKeys(cfg); err != nil {
+		return err
+	}
+	if err := validateAccessLog(cfg.RequestLogFields); err != nil {
+		return err
+	}
+	if err := validatePassthrough(cfg); err != nil {
+		return err
+	}
+	if err := validateParseLimit(cfg); err != nil {
+		return err
+	}
+	if cfg.MaxInFlight < 0 {
+		return fmt.Errorf("max_in_flight must not be negative")
+	}
+	if cfg.Metrics.Enabled && !strings.HasPrefix(cfg.Metrics.Path, "/") {
+		return fmt.Errorf("metrics.path must start with '/'")
+	}
+	if cfg.Recent.Size < 0 {
+		return fmt.Errorf("recent.size must not be negative")
+	}
+	if cfg.Recent.Size > 0 {
+		if !strings.HasPrefix(cfg.Recent.Path, "/") {
+			return fmt.Errorf("recent.path must start with '/'")
+		}
+		if cfg.Admin.Token == "" {
+			return fmt.Errorf("admin.token is required when recent is enabled")
+		}
+	}
+	if cfg.ConfigEndpoint.Enabled {
+		if !strings.HasPrefix(cfg.ConfigEndpoint.Path, "/") {
+			return fmt.Errorf("config_endpoint.path must start with '/'")
+		}
+		if cfg.Admin.Token == "" {
+			return fmt.Errorf("admin.token is required when config_endpoint is enabled")
+		}
+	}
+	if cfg.DebugInfo.Enabled {
+		if !strings.HasPrefix(cfg.DebugInfo.Path, "/") {
+			return fmt.Errorf("debug_info.path must start with '/'")
+		}
+		if cfg.Admin.Token == "" {
+			return fmt.Errorf("admin.token is required when debug_info is enabled")
+		}
+	}
+	if cfg.Live.Enabled {
+		if !strings.HasPrefix(cfg.Live.Path, "/") {
+			return fmt.Errorf("live.path must start with '/'")
+		}
+		if cfg.Live.ClientBuffer <= 0 {
+			return fmt.Errorf("live.client_buffer must be positive")
+		}
+		if cfg.Admin.Token == "" {
+			return fmt.Errorf("admin.token is required when live is enabled")
+		}
+	}
+	if cfg.RequireJSONBody && cfg.Protobuf.enabled() {
+		return fmt.Errorf("require_json_body cannot be used with protobuf bodies")
+	}
+	if (cfg.Protobuf.DescriptorSet == "") != (cfg.Protobuf.Message == "") {
+		return fmt.Errorf("protobuf.descriptor_set and protobuf.message must be set together")
+	}
+	if err := validateGeoIP(cfg.GeoIP); err != nil {
+		return err
+	}
+	if err := validateOutput(cfg.Output); err != nil {
+		return err
+	}
+	if err := validateRejections(cfg.Rejections); err != nil {
+		return err
+	}
+	if err := validateServer(cfg.Server); err != nil {
+		return err
+	}
+	if err := validateCompression(cfg.Compression); err != nil {
+		return err
+	}
+	if err := validateCORS(cfg.CORS); err != nil {
+		return err
+	}
+	switch cfg.RootMergeStrategy {
+	case RootMergeError, RootMergeFirst, RootMergeLast:
+	default:
+		return fmt.Errorf("unsupported root_merge_strategy %q (use error, first, or last)", cfg.RootMergeStrategy)
+	}
+
+	return nil
+}
+
+// validateMappings checks one mapping list. field names the list in error
+// messages, e.g. "mappings" or "routes[0].mappings".
+func validateMappings(field string, mappings []FieldMapping, keyCase KeyCase) error {
+	seen := map[string]string{}
+	for i, m := range mappings {
+		if len(m.Merge) > 0 {
+			if m.From != "" {
+				return fmt.Errorf("%s[%d] cannot set both from and merge", field, i)
+			}
+			if err := validateMappings(fmt.Sprintf("%s[%d].merge", field, i), m.Merge, KeyCaseAsIs); err != nil {
+				return err
+			}
+		} else if m.From == "" {
+			return fmt.Errorf("%s[%d].from is required", field, i)
+		} else if !m.From.known() {
+			return fmt.Errorf("%s[%d].from unsupported source %q (use %s)", field, i, m.From, sourceNames())
 		}
 		if m.Root && m.To != "" {
-			return fmt.Errorf("mappings[%d] cannot set both to and root", i)
+			return fmt.Errorf("%s[%d] cannot set both to and root", field, i)
 		}
 		if !m.Root && m.To == "" {
-			return fmt.Errorf("mappings[%d] must set to or root: true", i)
+			return fmt.Errorf("%s[%d] must set to or root: true", field, i)
+		}
+		for _, path := range m.ParseJSON {
+			if err := validatePath(path); err != nil {
+				return fmt.Errorf("%s[%d].parse_json: %w", field, i, err)
+			}
+		}
+		switch m.OnNonString {
+		case "", NonStringSkip, NonStringError:
+		default:
+			return fmt.Errorf("%s[%d].on_non_string %q is unsupported (use skip or error)", field, i, m.OnNonString)
+		}
+		switch m.OnError {
+		case "", OnErrorFail, OnErrorSkip, OnErrorDefault:
+		default:
+			return fmt.Errorf("%s[%d].on_error %q is unsupported (use fail, skip, or default)", field, i, m.OnError)
+		}
+		if m.Default != nil && m.OnError != OnErrorDefault {
+			return fmt.Errorf("%s[%d].default requires on_error: default", field, i)
+		}
+		if len(m.Keys) > 0 && m.From != SourceHeaders && m.From != SourceQuery {
+			return fmt.Errorf("%s[%d].keys is only supported for %q and %q", field, i, SourceHeaders, SourceQuery)
+		}
+		switch m.MergeQuery {
+		case "":
+		case MergeQueryPreferBody, MergeQueryPreferQuery:
+			if m.From != SourceBody {
+				return fmt.Errorf("%s[%d].merge_query is only supported for %q", field, i, SourceBody)
+			}
+		default:
+			return fmt.Errorf("%s[%d].merge_query %q is unsupported (use prefer_body or prefer_query)", field, i, m.MergeQuery)
+		}
+		if len(m.Include) > 0 && m.From != SourceBody {
+			return fmt.Errorf("%s[%d].include is only supported for %q", field, i, SourceBody)
+		}
+		included := make(map[string]struct{}, len(m.Include))
+		for _, path := range m.Include {
+			if err := validatePath(path); err != nil {
+				return fmt.Errorf("%s[%d].include: %w", field, i, err)
+			}
+			included[path] = struct{}{}
+		}
+		for path := range m.IncludeDefaults {
+			if _, ok := included[path]; !ok {
+				return fmt.Errorf("%s[%d].include_defaults key %q is not listed in include", field, i, path)
+			}
+		}
+		if _, err := newPipeline(m); err != nil {
+			return fmt.Errorf("%s[%d].%w", field, i, err)
 		}
 		if m.To == "" {
 			continue
 		}
-		if _, ok := seen[m.To]; ok {
-			return fmt.Errorf("duplicate output key %q", m.To)
+		key := normalizeKey(m.To, keyCase)
+		if prev, ok := seen[key]; ok {
+			if prev == m.To {
+				return fmt.Errorf("duplicate output key %q", m.To)
+			}
+			return fmt.Errorf("output keys %q and %q both normalize to %q under key_case %s", prev, m.To, key, keyCase)
 		}
-		seen[m.To] = struct{}{}
-	}
-
-	if cfg.AckStatus < 100 || cfg.AckStatus > 599 {
-		return fmt.Errorf("ack_status must be a valid HTTP status code")
-	}
-	if _, err := parseLogLevel(cfg.LogLevel); err != nil {
-		return err
+		seen[key] = m.To
 	}
 
 	return nil
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The config from the README's YAML anchors section.
+const anchorsConfig = `
+x-common:
+  body: &body_mapping
+    from: body
+    to: payload
+    include: [event]
+  mappings: &github_mappings
+    - *body_mapping
+    - from: headers
+      to: headers
+      keys: [X-GitHub-Event]
+
+routes:
+  - path: /hooks/github
+    mappings: *github_mappings
+  - path: /hooks/other
+    mappings:
+      - <<: *body_mapping
+        include: [id]
+      - from: method
+        to: method
+`
+
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigYAMLAnchors(t *testing.T) {
+	cfg, err := loadConfig(writeConfig(t, "config.yaml", anchorsConfig))
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if len(cfg.Routes) != 2 {
+		t.Fatalf("got %d routes, want 2", len(cfg.Routes))
+	}
+
+	// An alias expands to a copy of the anchored list and mapping.
+	wantGitHub := []FieldMapping{
+		{From: SourceBody, To: "payload", Include: []string{"event"}},
+		{From: SourceHeaders, To: "headers", Keys: []string{"X-GitHub-Event"}},
+	}
+	if got := cfg.Routes[0].Mappings; !reflect.DeepEqual(got, wantGitHub) {
+		t.Errorf("routes[0].mappings = %+v, want %+v", got, wantGitHub)
+	}
+
+	// A merge key copies the anchored fields, and keys set next to it
+	// override them.
+	wantOther := []FieldMapping{
+		{From: SourceBody, To: "payload", Include: []string{"id"}},
+		{From: SourceMethod, To: "method"},
+	}
+	if got := cfg.Routes[1].Mappings; !reflect.DeepEqual(got, wantOther) {
+		t.Errorf("routes[1].mappings = %+v, want %+v", got, wantOther)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/cors"
+)
+
+// CORSConfig answers browser preflight requests on webhook routes. When
+// enabled, preflights get 204 with the allowed origins, methods, and
+// headers, and are never written to the output.
+type CORSConfig struct {
+	Enabled      bool     `json:"enabled" yaml:"enabled"`
+	AllowOrigins []string `json:"allow_origins" yaml:"allow_origins"`
+	AllowMethods []string `json:"allow_methods" yaml:"allow_methods"`
+	AllowHeaders []string `json:"allow_headers" yaml:"allow_headers"`
+	MaxAge       int      `json:"max_age" yaml:"max_age"`
+}
+
+func validateCORS(cfg CORSConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	for i, origin := range cfg.AllowOrigins {
+		if origin == "*" {
+			continue
+		}
+		// Subdomain wildcards such as https://*.example.com are allowed.
+		u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+		if err != nil || u.Scheme == "" || u.Host == "" || strings.Contains(u.Host, "*") || strings.Trim(u.Path, "/") != "" {
+			return fmt.Errorf("cors.allow_origins[%d] %q must be \"*\" or an origin like https://example.com", i, origin)
+		}
+	}
+	if cfg.MaxAge < 0 {
+		return fmt.Errorf("cors.max_age must not be negative")
+	}
+	return nil
+}
+
+// newCORS returns the CORS middleware for webhook routes. Empty lists
+// fall back to fiber's defaults: any origin and the common methods.
+func newCORS(cfg CORSConfig) fiber.Handler {
+	return cors.New(cors.Config{
+		AllowOrigins: cfg.AllowOrigins,
+		AllowMethods: cfg.AllowMethods,
+		AllowHeaders: cfg.AllowHeaders,
+		MaxAge:       cfg.MaxAge,
+	})
+}
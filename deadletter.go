@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+)
+
+// DeadLetterConfig captures requests that are rejected for their content,
+// such as failed signatures or mappings, to a separate JSON lines file
+// for later inspection, away from the main output.
+type DeadLetterConfig struct {
+	Path string `json:"path" yaml:"path"`
+}
+
+// deadLetter appends one JSON line per rejected request. A nil
+// *deadLetter discards everything, so callers need not check.
+type deadLetter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newDeadLetter opens the dead-letter file for appending. It is created
+// owner-only, because it holds raw requests including their credentials.
+func newDeadLetter(cfg DeadLetterConfig) (*deadLetter, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter file: %w", err)
+	}
+	return &deadLetter{file: f}, nil
+}
+
+// Write records the raw request with the rejection reason and error.
+func (d *deadLetter) Write(c fiber.Ctx, raw []byte, reason string, err error) error {
+	return d.writeRecord(d.record(c, raw, reason, err))
+}
+
+// record captures the request as a dead-letter record, for writing now or
+// after the request has ended. The body is kept as a string, or base64
+// with body_base64 set when it is not valid UTF-8, so it can be replayed
+// byte for byte. Strings are copied, since request memory is reused once
+// the handler returns. A nil *deadLetter returns nil.
+func (d *deadLetter) record(c fiber.Ctx, raw []byte, reason string, err error) map[string]any {
+	if d == nil {
+		return nil
+	}
+
+	record := map[string]any{
+		"received_at": time.Now().UTC().Format(time.RFC3339Nano),
+		"reason":      reason,
+		"method":      strings.Clone(c.Method()),
+		"path":        strings.Clone(c.Path()),
+		"route":       c.Route().Path,
+		"source_ip":   strings.Clone(c.IP()),
+		"request_id":  strings.Clone(requestid.FromContext(c)),
+		"headers":     cloneHeaders(c.GetReqHeaders()),
+		"query":       string(c.Request().URI().QueryString()),
+	}
+	if err != nil {
+		record["error"] = err.Error()
+	}
+	if utf8.Valid(raw) {
+		record["body"] = string(raw)
+	} else {
+		record["body"] = base64.StdEncoding.EncodeToString(raw)
+		record["body_base64"] = true
+	}
+	return record
+}
+
+func (d *deadLetter) writeRecord(record map[string]any) error {
+	if d == nil {
+		return nil
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err = d.file.Write(append(line, '\n'))
+	return err
+}
+
+func (d *deadLetter) Close() error {
+	if d == nil {
+		return nil
+	}
+	return d.file.Close()
+}
+
+func cloneHeaders(headers map[string][]string) map[string][]string {
+	cp := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		vs := make([]string, len(values))
+		for i, v := range values {
+			vs[i] = strings.Clone(v)
+		}
+		cp[strings.Clone(name)] = vs
+	}
+	return cp
+}
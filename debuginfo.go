@@ -0,0 +1,69 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// DebugInfoConfig serves build, uptime, request count, and feature
+// information at one admin endpoint, for quick support diagnosis.
+type DebugInfoConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Path    string `json:"path" yaml:"path"`
+}
+
+// buildInfo describes the running binary from the build info embedded by
+// the Go toolchain. Fields the build did not record are left empty.
+func buildInfo() map[string]any {
+	info := map[string]any{"go": runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info["version"] = bi.Main.Version
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info["revision"] = s.Value
+		case "vcs.time":
+			info["revision_time"] = s.Value
+		case "vcs.modified":
+			info["modified"] = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// debugInfoHandler answers with the build, uptime, request counts, and
+// the features the config turns on. Features come from featureSummary,
+// which reports only whether secrets are set, never their values.
+func debugInfoHandler(cfg Config, stats *metrics, started time.Time) fiber.Handler {
+	build := buildInfo()
+	summary := featureSummary(cfg)
+	features := make(map[string]any, len(summary)/2)
+	for i := 0; i+1 < len(summary); i += 2 {
+		features[summary[i].(string)] = summary[i+1]
+	}
+
+	return func(c fiber.Ctx) error {
+		counts := stats.responseCounts()
+		var total int64
+		for _, n := range counts {
+			total += n
+		}
+		return c.JSON(fiber.Map{
+			"build":          build,
+			"started_at":     started.UTC().Format(time.RFC3339),
+			"uptime_seconds": int64(time.Since(started).Seconds()),
+			"requests": fiber.Map{
+				"total":     total,
+				"in_flight": stats.inFlight.Load(),
+				"by_status": counts,
+			},
+			"features": features,
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const elasticsearchTimeout = 30 * time.Second
+
+// ElasticsearchAuth holds credentials for the bulk API. Set either
+// username and password or api_key.
+type ElasticsearchAuth struct {
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	APIKey   string `json:"api_key" yaml:"api_key"`
+}
+
+// elasticsearchSink indexes records through the Elasticsearch/OpenSearch
+// _bulk API. Records are buffered and sent when batch_size is reached or
+// every flush interval; whatever is buffered is sent on Close.
+type elasticsearchSink struct {
+	mu      sync.Mutex
+	sendMu  sync.Mutex
+	url     string
+	index   outputTemplate
+	auth    ElasticsearchAuth
+	limit   int
+	client  *http.Client
+	logger  *slog.Logger
+	pending bytes.Buffer
+	count   int
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newElasticsearchSink(cfg OutputConfig, logger *slog.Logger) (*elasticsearchSink, error) {
+	index, err := parseOutputTemplate(cfg.Index)
+	if err != nil {
+		return nil, fmt.Errorf("output.index: %w", err)
+	}
+	s := &elasticsearchSink{
+		url:    strings.TrimRight(cfg.URL, "/") + "/_bulk",
+		index:  index,
+		auth:   cfg.Auth,
+		limit:  cfg.BatchSize,
+		client: &http.Client{Timeout: elasticsearchTimeout},
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.flushLoop(time.Duration(cfg.FlushInterval))
+	return s, nil
+}
+
+func (s *elasticsearchSink) flushLoop(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *elasticsearchSink) Write(line []byte) error {
+	var record any
+	if err := json.Unmarshal(line, &record); err != nil {
+		return fmt.Errorf("elasticsearch output: %w", err)
+	}
+	action, err := json.Marshal(map[string]any{
+		"index": map[string]string{"_index": s.index.render(record, elasticsearchIndexName)},
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.pending.Write(action)
+	s.pending.WriteByte('\n')
+	// Pretty-printed lines must be compacted: the bulk body is NDJSON.
+	if err := json.Compact(&s.pending, line); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.pending.WriteByte('\n')
+	s.count++
+	full := s.count >= s.limit
+	s.mu.Unlock()
+
+	if full {
+		s.flush()
+	}
+	return nil
+}
+
+// flush sends the buffered records. Sends are serialized so batches reach
+// the cluster in order; failures are logged and the batch is dropped.
+func (s *elasticsearchSink) flush() {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	if s.count == 0 {
+		s.mu.Unlock()
+		return
+	}
+	body := bytes.Clone(s.pending.Bytes())
+	count := s.count
+	s.pending.Reset()
+	s.count = 0
+	s.mu.Unlock()
+
+	if err := s.send(body); err != nil {
+		s.logger.Error("elasticsearch bulk request failed", "records", count, "error", err)
+	}
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Index  string `json:"_index"`
+		Status int    `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func (s *elasticsearchSink) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	s.authorize(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+
+	var result bulkResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("decode bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	for i, item := range result.Items {
+		for action, r := range item {
+			if r.Error == nil {
+				continue
+			}
+			s.logger.Warn("elasticsearch bulk item failed",
+				"item", i, "action", action, "index", r.Index, "status", r.Status,
+				"error_type", r.Error.Type, "error", r.Error.Reason)
+		}
+	}
+	return nil
+}
+
+func (s *elasticsearchSink) authorize(req *http.Request) {
+	switch {
+	case s.auth.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.auth.APIKey)
+	case s.auth.Username != "":
+		req.SetBasicAuth(s.auth.Username, s.auth.Password)
+	}
+}
+
+// Preflight checks that the cluster answers its root endpoint with the
+// configured credentials.
+func (s *elasticsearchSink) Preflight() error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(s.url, "/_bulk")+"/", nil)
+	if err != nil {
+		return err
+	}
+	s.authorize(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("elasticsearch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("elasticsearch: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *elasticsearchSink) Close() error {
+	close(s.stop)
+	<-s.done
+	s.flush()
+	return nil
+}
+
+// elasticsearchIndexName makes a templated value safe inside an index
+// name: lowercase, with anything but letters, digits, '-', '_' and '.'
+// replaced by '_'.
+func elasticsearchIndexName(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '_'
+		}
+	}, value)
+}
+
+// elasticsearchIndexForbidden holds the characters Elasticsearch and
+// OpenSearch reject in index names.
+const elasticsearchIndexForbidden = `\/*?"<>| ,#:`
+
+// validateElasticsearchIndex checks the literal parts of an index
+// template against the index name rules, since Elasticsearch would reject
+// every bulk request otherwise. Placeholder values are made safe by
+// elasticsearchIndexName when rendered.
+func validateElasticsearchIndex(index outputTemplate) error {
+	for _, literal := range index.literals {
+		if literal != strings.ToLower(literal) {
+			return fmt.Errorf("index names must be lowercase")
+		}
+		if i := strings.IndexAny(literal, elasticsearchIndexForbidden); i >= 0 {
+			return fmt.Errorf("index names must not contain %q", literal[i])
+		}
+	}
+	if first := index.literals[0]; first != "" && strings.ContainsAny(first[:1], "-_+") {
+		return fmt.Errorf("index names must not start with %q", first[0])
+	}
+	if len(index.paths) == 0 && (index.literals[0] == "." || index.literals[0] == "..") {
+		return fmt.Errorf("index name must not be %q", index.literals[0])
+	}
+	return nil
+}
+
+func validateElasticsearch(cfg OutputConfig) error {
+	u, err := url.Parse(cfg.URL)
+	if cfg.URL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("output.url must be an http or https URL in %q mode", OutputElasticsearch)
+	}
+	if cfg.Index == "" {
+		return fmt.Errorf("output.index is required in %q mode", OutputElasticsearch)
+	}
+	index, err := parseOutputTemplate(cfg.Index)
+	if err != nil {
+		return fmt.Errorf("output.index: %w", err)
+	}
+	if err := validateElasticsearchIndex(index); err != nil {
+		return fmt.Errorf("output.index: %w", err)
+	}
+	if cfg.BatchSize <= 0 {
+		return fmt.Errorf("output.batch_size must be positive")
+	}
+	if cfg.FlushInterval <= 0 {
+		return fmt.Errorf("output.flush_interval must be positive in %q mode", OutputElasticsearch)
+	}
+	if cfg.Auth.APIKey != "" && cfg.Auth.Username != "" {
+		return fmt.Errorf("output.auth must set either api_key or username, not both")
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestValidateElasticsearchIndex(t *testing.T) {
+	tests := []struct {
+		index   string
+		wantErr string
+	}{
+		{index: "webhooks"},
+		{index: "webhooks-{{ date }}"},
+		{index: "{{ body.repository.name }}-events"},
+		{index: "webhooks.v2_{{ Body.Name }}"},
+		{index: "Webhooks-{{ date }}", wantErr: "output.index: index names must be lowercase"},
+		{index: "webhooks-{{ date }}-EU", wantErr: "output.index: index names must be lowercase"},
+		{index: "web hooks", wantErr: `output.index: index names must not contain ' '`},
+		{index: "webhooks,other", wantErr: `output.index: index names must not contain ','`},
+		{index: "webhooks#1", wantErr: `output.index: index names must not contain '#'`},
+		{index: `logs\{{ date }}`, wantErr: `output.index: index names must not contain '\\'`},
+		{index: "logs/{{ date }}", wantErr: `output.index: index names must not contain '/'`},
+		{index: "logs*", wantErr: `output.index: index names must not contain '*'`},
+		{index: "web:hooks", wantErr: `output.index: index names must not contain ':'`},
+		{index: "-webhooks", wantErr: `output.index: index names must not start with '-'`},
+		{index: "_webhooks", wantErr: `output.index: index names must not start with '_'`},
+		{index: "+{{ date }}", wantErr: `output.index: index names must not start with '+'`},
+		{index: "..", wantErr: `output.index: index name must not be ".."`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.index, func(t *testing.T) {
+			cfg := defaultConfig().Output
+			cfg.Mode = OutputElasticsearch
+			cfg.URL = "http://localhost:9200"
+			cfg.Index = tt.index
+
+			err := validateElasticsearch(cfg)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("validateElasticsearch() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("validateElasticsearch() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
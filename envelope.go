@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+)
+
+// EnvelopeConfig wraps every record in a fixed envelope: the mapped
+// output under DataField, next to the chosen request metadata fields and
+// any output_meta.
+type EnvelopeConfig struct {
+	Enabled   bool     `json:"enabled" yaml:"enabled"`
+	DataField string   `json:"data_field" yaml:"data_field"`
+	Fields    []string `json:"fields" yaml:"fields"`
+}
+
+// envelopeFields are the metadata fields an envelope can carry.
+var envelopeFields = map[string]func(c fiber.Ctx, received time.Time) any{
+	"received_at": func(_ fiber.Ctx, received time.Time) any { return received.UTC().Format(time.RFC3339Nano) },
+	"source_ip":   func(c fiber.Ctx, _ time.Time) any { return c.IP() },
+	"request_id":  func(c fiber.Ctx, _ time.Time) any { return requestid.FromContext(c) },
+	"method":      func(c fiber.Ctx, _ time.Time) any { return c.Method() },
+	"path":        func(c fiber.Ctx, _ time.Time) any { return c.Path() },
+	"route":       func(c fiber.Ctx, _ time.Time) any { return c.Route().Path },
+}
+
+func validateEnvelope(cfg Config) error {
+	env := cfg.Envelope
+	if !env.Enabled {
+		return nil
+	}
+	if cfg.OutputWrapper != "" {
+		return fmt.Errorf("envelope and output_wrapper cannot both be set")
+	}
+	if env.DataField == "" {
+		return fmt.Errorf("envelope.data_field must not be empty")
+	}
+	for _, name := range env.Fields {
+		if _, ok := envelopeFields[name]; !ok {
+			return fmt.Errorf("unsupported envelope field %q (use %s)", name, envelopeFieldNames())
+		}
+		if name == env.DataField {
+			return fmt.Errorf("envelope field %q collides with envelope.data_field", name)
+		}
+		if _, ok := cfg.OutputMeta[name]; ok {
+			return fmt.Errorf("output_meta key %q collides with envelope field", name)
+		}
+	}
+	if _, ok := cfg.OutputMeta[env.DataField]; ok {
+		return fmt.Errorf("output_meta key %q collides with envelope.data_field", env.DataField)
+	}
+	return nil
+}
+
+// envelopeMeta returns output_meta plus the envelope's metadata fields for
+// this request, ready for wrapOutput.
+func envelopeMeta(c fiber.Ctx, cfg Config, received time.Time) map[string]any {
+	meta := make(map[string]any, len(cfg.OutputMeta)+len(cfg.Envelope.Fields))
+	for k, v := range cfg.OutputMeta {
+		meta[k] = v
+	}
+	for _, name := range cfg.Envelope.Fields {
+		meta[name] = envelopeFields[name](c, received)
+	}
+	return meta
+}
+
+func envelopeFieldNames() string {
+	names := make([]string, 0, len(envelopeFields))
+	for name := range envelopeFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	execMinBackoff = 100 * time.Millisecond
+	execMaxBackoff = 30 * time.Second
+	execStopWait   = 5 * time.Second
+	// execStableUptime is how long the command must stay up before the
+	// backoff resets. A command that exits sooner counts as a failed start,
+	// so a crash loop is not re-forked on every write.
+	execStableUptime = 10 * time.Second
+)
+
+// execSink writes each line to the stdin of a long-running command. If the
+// command exits it is restarted on the next write, waiting with exponential
+// backoff between attempts; writes made while it is down fail so the
+// sender gets an error and can retry.
+type execSink struct {
+	mu        sync.Mutex
+	command   string
+	args      []string
+	logger    *slog.Logger
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	exited    chan struct{}
+	startedAt time.Time
+	// uptime is how long the last process ran. It is set before exited is
+	// closed, so it may be read once exited is.
+	uptime time.Duration
+	// failed is set when a write to the current process already counted
+	// as a failure, so its exit is not counted again.
+	failed    bool
+	backoff   time.Duration
+	nextStart time.Time
+}
+
+func newExecSink(command string, args []string, logger *slog.Logger) (*execSink, error) {
+	s := &execSink{command: command, args: args, logger: logger, backoff: execMinBackoff}
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Preflight checks that the command started and is still running.
+func (s *execSink) Preflight() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.exited:
+		return fmt.Errorf("exec output: command %q exited", s.command)
+	default:
+		return nil
+	}
+}
+
+func (s *execSink) start() error {
+	cmd := exec.Command(s.command, s.args...)
+	// The command's own output goes to stderr so it cannot be confused
+	// with records or service logs on stdout.
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("exec output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("exec output: %w", err)
+	}
+
+	started := time.Now()
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		uptime := time.Since(started)
+		s.logger.Warn("exec output command exited", "command", s.command, "uptime", uptime.Round(time.Millisecond), "error", err)
+		s.uptime = uptime
+		close(exited)
+	}()
+
+	s.cmd, s.stdin, s.exited, s.startedAt, s.failed = cmd, stdin, exited, started, false
+	return nil
+}
+
+func (s *execSink) running() bool {
+	if s.cmd == nil {
+		return false
+	}
+	select {
+	case <-s.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// noteExit records the exit of the current process: one that stayed up
+// past execStableUptime resets the backoff, one that did not counts as a
+// failure. It must be called once per process, after exited is closed.
+func (s *execSink) noteExit() {
+	switch {
+	case s.failed:
+		// Already counted when the write to it failed.
+	case s.uptime < execStableUptime:
+		s.fail()
+	default:
+		s.backoff = execMinBackoff
+	}
+	s.cmd = nil
+}
+
+// restart starts a new process unless the backoff window since the last
+// failure is still open.
+func (s *execSink) restart() error {
+	if now := time.Now(); now.Before(s.nextStart) {
+		return fmt.Errorf("exec output command is down, restarting in %s", s.nextStart.Sub(now).Round(time.Millisecond))
+	}
+	s.cmd = nil
+	if err := s.start(); err != nil {
+		s.fail()
+		return err
+	}
+	return nil
+}
+
+func (s *execSink) fail() {
+	s.nextStart = time.Now().Add(s.backoff)
+	s.backoff = min(s.backoff*2, execMaxBackoff)
+}
+
+func (s *execSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running() {
+		if s.cmd != nil {
+			s.noteExit()
+		}
+		if err := s.restart(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.stdin.Write(line); err != nil {
+		if !s.failed {
+			s.fail()
+			s.failed = true
+		}
+		return fmt.Errorf("exec output: %w", err)
+	}
+	// A successful write alone says little about a command that may be
+	// about to crash; only one that has stayed up resets the backoff.
+	if time.Since(s.startedAt) >= execStableUptime {
+		s.backoff = execMinBackoff
+	}
+	return nil
+}
+
+// Close closes the command's stdin so it can finish reading, then waits
+// for it to exit, killing it if it takes too long.
+func (s *execSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running() {
+		return nil
+	}
+	err := s.stdin.Close()
+	select {
+	case <-s.exited:
+	case <-time.After(execStopWait):
+		err = errors.Join(err, s.cmd.Process.Kill())
+		<-s.exited
+	}
+	return err
+}
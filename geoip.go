@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// GeoIPConfig enriches records with the client IP's country and ASN from
+// MaxMind databases. Database may hold both (GeoIP2/GeoLite2 Country or
+// City); ASNDatabase adds a separate GeoLite2-ASN file.
+type GeoIPConfig struct {
+	Database    string `json:"database" yaml:"database"`
+	ASNDatabase string `json:"asn_database" yaml:"asn_database"`
+	Field       string `json:"field" yaml:"field"`
+}
+
+func (g GeoIPConfig) enabled() bool {
+	return g.Database != "" || g.ASNDatabase != ""
+}
+
+func validateGeoIP(cfg GeoIPConfig) error {
+	if cfg.enabled() && cfg.Field == "" {
+		return fmt.Errorf("geoip.field must not be empty")
+	}
+	return nil
+}
+
+// geoRecord is the subset of a MaxMind record that is emitted.
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN uint `maxminddb:"autonomous_system_number"`
+}
+
+type geoIP struct {
+	readers []*maxminddb.Reader
+}
+
+func newGeoIP(cfg GeoIPConfig) (*geoIP, error) {
+	g := &geoIP{}
+	for _, path := range []string{cfg.Database, cfg.ASNDatabase} {
+		if path == "" {
+			continue
+		}
+		r, err := maxminddb.Open(path)
+		if err != nil {
+			g.Close()
+			return nil, fmt.Errorf("open %s: %w", path, err)
+		}
+		g.readers = append(g.readers, r)
+	}
+	return g, nil
+}
+
+// lookup returns the country ISO code and ASN for ip. Values that are
+// unknown, including for unparsable or private addresses, are nil.
+func (g *geoIP) lookup(ip string) map[string]any {
+	geo := map[string]any{"country": nil, "asn": nil}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return geo
+	}
+
+	var rec geoRecord
+	for _, r := range g.readers {
+		_ = r.Lookup(addr.Unmap()).Decode(&rec)
+	}
+	if rec.Country.ISOCode != "" {
+		geo["country"] = rec.Country.ISOCode
+	}
+	if rec.ASN != 0 {
+		geo["asn"] = rec.ASN
+	}
+	return geo
+}
+
+func (g *geoIP) Close() {
+	for _, r := range g.readers {
+		_ = r.Close()
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// JWTConfig reads a JWT from a request header for the jwt source. With
+// secret (HS256/384/512) or public_key (PEM, RS/PS/ES algorithms) set,
+// every request must carry a valid, unexpired token; otherwise tokens are
+// only decoded.
+type JWTConfig struct {
+	Header    string `json:"header" yaml:"header"`
+	Secret    string `json:"secret" yaml:"secret"`
+	PublicKey string `json:"public_key" yaml:"public_key"`
+
+	// publicKey is PublicKey parsed by loadConfig.
+	publicKey crypto.PublicKey
+}
+
+func (cfg JWTConfig) verifying() bool {
+	return cfg.Secret != "" || cfg.PublicKey != ""
+}
+
+type jwtKey struct{}
+
+type jwtResult struct {
+	claims map[string]any
+	err    error
+}
+
+// readJWT decodes the request's JWT, verifying it when a key is
+// configured, and keeps the claims for the jwt source. It returns an error
+// only for verification failures; in decode-only mode a malformed token is
+// reported by jwt mappings instead.
+func readJWT(c fiber.Ctx, cfg JWTConfig, now time.Time) error {
+	token := strings.TrimSpace(c.Get(cfg.Header))
+	if scheme, rest, ok := strings.Cut(token, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(rest)
+	}
+	if token == "" {
+		if cfg.verifying() {
+			return fmt.Errorf("missing JWT in %s header", cfg.Header)
+		}
+		c.Locals(jwtKey{}, jwtResult{})
+		return nil
+	}
+
+	claims, err := parseJWT(token, cfg, now)
+	c.Locals(jwtKey{}, jwtResult{claims: claims, err: err})
+	if cfg.verifying() {
+		return err
+	}
+	return nil
+}
+
+// requestJWTClaims returns the claims stored by readJWT, or nil when the
+// request had no token.
+func requestJWTClaims(c fiber.Ctx) (any, error) {
+	r, _ := c.Locals(jwtKey{}).(jwtResult)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.claims == nil {
+		return nil, nil
+	}
+	return r.claims, nil
+}
+
+func parseJWT(token string, cfg JWTConfig, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("JWT header: %w", err)
+	}
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("JWT claims: %w", err)
+	}
+	if !cfg.verifying() {
+		return claims, nil
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("JWT signature: %w", err)
+	}
+	if err := verifyJWTSignature(header.Alg, parts[0]+"."+parts[1], signature, cfg); err != nil {
+		return nil, err
+	}
+	if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("JWT has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("JWT is not valid yet")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, dst any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+// verifyJWTSignature checks signature over input. The algorithm family
+// must match the configured key, so an attacker cannot pick "none" or
+// make a public key act as an HMAC secret.
+func verifyJWTSignature(alg, input string, signature []byte, cfg JWTConfig) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported JWT algorithm %q", alg)
+	}
+	family := alg[:2]
+	hash, ok := jwtHashes[alg[2:]]
+	if !ok {
+		return fmt.Errorf("unsupported JWT algorithm %q", alg)
+	}
+
+	if cfg.Secret != "" {
+		if family != "HS" {
+			return fmt.Errorf("JWT algorithm %q does not match the configured secret", alg)
+		}
+		mac := hmac.New(hash.New, []byte(cfg.Secret))
+		mac.Write([]byte(input))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("JWT signature mismatch")
+		}
+		return nil
+	}
+
+	h := hash.New()
+	h.Write([]byte(input))
+	digest := h.Sum(nil)
+
+	switch key := cfg.publicKey.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch family {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(key, hash, digest, signature)
+		case "PS":
+			err = rsa.VerifyPSS(key, hash, digest, signature, nil)
+		default:
+			return fmt.Errorf("JWT algorithm %q does not match the configured RSA key", alg)
+		}
+		if err != nil {
+			return errors.New("JWT signature mismatch")
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if family != "ES" {
+			return fmt.Errorf("JWT algorithm %q does not match the configured EC key", alg)
+		}
+		if len(signature) != 2*size {
+			return errors.New("JWT signature mismatch")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("JWT signature mismatch")
+		}
+	default:
+		return errors.New("no JWT verification key")
+	}
+	return nil
+}
+
+// parseJWTPublicKey parses a PEM-encoded RSA or EC public key.
+func parseJWTPublicKey(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
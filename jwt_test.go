@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+const jwtTestSecret = "jwt-test-secret"
+
+var jwtTestNow = time.Unix(1700000000, 0)
+
+// signTestJWT builds a token with the given header alg and claims, signed
+// by sign over the encoded header and claims.
+func signTestJWT(t *testing.T, alg string, claims map[string]any, sign func(input string) []byte) string {
+	t.Helper()
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	input := encode(map[string]any{"alg": alg, "typ": "JWT"}) + "." + encode(claims)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sign(input))
+}
+
+func hs256(secret string) func(string) []byte {
+	return func(input string) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(input))
+		return mac.Sum(nil)
+	}
+}
+
+func rs256(t *testing.T, key *rsa.PrivateKey) func(string) []byte {
+	return func(input string) []byte {
+		digest := sha256.Sum256([]byte(input))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+}
+
+func es256(t *testing.T, key *ecdsa.PrivateKey) func(string) []byte {
+	return func(input string) []byte {
+		digest := sha256.Sum256([]byte(input))
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+}
+
+// publicKeyJWTConfig returns a config verifying with pub, parsed from PEM
+// the way loadConfig does.
+func publicKeyJWTConfig(t *testing.T, pub crypto.PublicKey) JWTConfig {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := JWTConfig{Header: "Authorization", PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))}
+	if cfg.publicKey, err = parseJWTPublicKey(cfg.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestParseJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secretCfg := JWTConfig{Header: "Authorization", Secret: jwtTestSecret}
+	rsaCfg := publicKeyJWTConfig(t, &rsaKey.PublicKey)
+	ecCfg := publicKeyJWTConfig(t, &ecKey.PublicKey)
+
+	claims := map[string]any{"sub": "123"}
+	unsigned := func(string) []byte { return nil }
+
+	tests := []struct {
+		name    string
+		token   string
+		cfg     JWTConfig
+		wantErr string
+	}{
+		{name: "valid HS256", token: signTestJWT(t, "HS256", claims, hs256(jwtTestSecret)), cfg: secretCfg},
+		{name: "valid RS256", token: signTestJWT(t, "RS256", claims, rs256(t, rsaKey)), cfg: rsaCfg},
+		{name: "valid ES256", token: signTestJWT(t, "ES256", claims, es256(t, ecKey)), cfg: ecCfg},
+		{name: "alg none with secret", token: signTestJWT(t, "none", claims, unsigned), cfg: secretCfg, wantErr: `unsupported JWT algorithm "none"`},
+		{name: "alg none with public key", token: signTestJWT(t, "none", claims, unsigned), cfg: rsaCfg, wantErr: `unsupported JWT algorithm "none"`},
+		{
+			// The public key is known to everyone, so a token MACed with
+			// it must not pass as signed by the key's owner.
+			name:    "HS256 with RSA public key as secret",
+			token:   signTestJWT(t, "HS256", claims, hs256(rsaCfg.PublicKey)),
+			cfg:     rsaCfg,
+			wantErr: `JWT algorithm "HS256" does not match the configured RSA key`,
+		},
+		{name: "RS256 with secret", token: signTestJWT(t, "RS256", claims, rs256(t, rsaKey)), cfg: secretCfg, wantErr: `JWT algorithm "RS256" does not match the configured secret`},
+		{name: "ES256 with RSA key", token: signTestJWT(t, "ES256", claims, es256(t, ecKey)), cfg: rsaCfg, wantErr: `JWT algorithm "ES256" does not match the configured RSA key`},
+		{name: "RS256 with EC key", token: signTestJWT(t, "RS256", claims, rs256(t, rsaKey)), cfg: ecCfg, wantErr: `JWT algorithm "RS256" does not match the configured EC key`},
+		{name: "HS256 wrong secret", token: signTestJWT(t, "HS256", claims, hs256("other-secret")), cfg: secretCfg, wantErr: "JWT signature mismatch"},
+		{name: "RS256 wrong key", token: signTestJWT(t, "RS256", claims, rs256(t, otherRSAKey)), cfg: rsaCfg, wantErr: "JWT signature mismatch"},
+		{name: "ES256 truncated signature", token: signTestJWT(t, "ES256", claims, func(input string) []byte { return es256(t, ecKey)(input)[:63] }), cfg: ecCfg, wantErr: "JWT signature mismatch"},
+		{
+			name:    "expired",
+			token:   signTestJWT(t, "HS256", map[string]any{"exp": jwtTestNow.Add(-time.Minute).Unix()}, hs256(jwtTestSecret)),
+			cfg:     secretCfg,
+			wantErr: "JWT has expired",
+		},
+		{
+			name:    "not valid yet",
+			token:   signTestJWT(t, "HS256", map[string]any{"nbf": jwtTestNow.Add(time.Minute).Unix()}, hs256(jwtTestSecret)),
+			cfg:     secretCfg,
+			wantErr: "JWT is not valid yet",
+		},
+		{
+			name:  "within exp and nbf",
+			token: signTestJWT(t, "HS256", map[string]any{"nbf": jwtTestNow.Add(-time.Minute).Unix(), "exp": jwtTestNow.Add(time.Minute).Unix()}, hs256(jwtTestSecret)),
+			cfg:   secretCfg,
+		},
+		{name: "two segments", token: "eyJhbGciOiJIUzI1NiJ9.e30", cfg: secretCfg, wantErr: "malformed JWT"},
+		{name: "four segments", token: signTestJWT(t, "HS256", claims, hs256(jwtTestSecret)) + ".x", cfg: secretCfg, wantErr: "malformed JWT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseJWT(tt.token, tt.cfg, jwtTestNow)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("parseJWT() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("parseJWT() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
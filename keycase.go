@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type KeyCase string
+
+const (
+	KeyCaseAsIs  KeyCase = "as_is"
+	KeyCaseLower KeyCase = "lower"
+	KeyCaseSnake KeyCase = "snake"
+)
+
+func normalizeKey(key string, keyCase KeyCase) string {
+	switch keyCase {
+	case KeyCaseLower:
+		return strings.ToLower(key)
+	case KeyCaseSnake:
+		return toSnakeCase(key)
+	default:
+		return key
+	}
+}
+
+// toSnakeCase converts keys like "eventType", "EventType", "event-type",
+// and "HTTPStatus" to "event_type" and "http_status".
+func toSnakeCase(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+	for i, r := range runes {
+		switch {
+		case r == '-' || r == ' ' || r == '.':
+			r = '_'
+		case unicode.IsUpper(r):
+			if i > 0 && runes[i-1] != '_' {
+				prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+					b.WriteRune('_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// applyKeyCase normalizes the top-level keys of an object output. Keys that
+// collide after normalization are resolved by policy, taking keys in
+// sorted order so first and last are stable.
+func applyKeyCase(output any, keyCase KeyCase, policy KeyCollisionPolicy) (any, error) {
+	obj, ok := output.(map[string]any)
+	if !ok || keyCase == KeyCaseAsIs {
+		return output, nil
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	normalized := make(map[string]any, len(obj))
+	origins := make(map[string]string, len(obj))
+	for _, k := range keys {
+		v := obj[k]
+		nk := normalizeKey(k, keyCase)
+		if prev, exists := origins[nk]; exists {
+			switch policy {
+			case KeyCollisionFirst:
+				continue
+			case KeyCollisionLast:
+			default:
+				return nil, fmt.Errorf("key_case %s: keys %q and %q both normalize to %q", keyCase, prev, k, nk)
+			}
+		}
+		origins[nk] = k
+		normalized[nk] = v
+	}
+	return normalized, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// LimitPolicy decides what happens to a request that sends more headers
+// or query parameters than max_headers or max_query_params allow.
+type LimitPolicy string
+
+const (
+	LimitTruncate LimitPolicy = "truncate"
+	LimitReject   LimitPolicy = "reject"
+)
+
+type requestLimitsKey struct{}
+
+// requestLimits are the caps a truncated request is held to. The handler
+// stores them in Locals so the headers and query sources can apply them.
+type requestLimits struct {
+	headers int
+	query   int
+}
+
+// checkRequestLimits reports the first of max_headers or max_query_params
+// the request goes over. A zero cap is never exceeded.
+func checkRequestLimits(c fiber.Ctx, cfg Config) error {
+	if n := c.Request().Header.Len(); cfg.MaxHeaders > 0 && n > cfg.MaxHeaders {
+		return fmt.Errorf("request has %d headers (max %d)", n, cfg.MaxHeaders)
+	}
+	if n := c.RequestCtx().QueryArgs().Len(); cfg.MaxQueryParams > 0 && n > cfg.MaxQueryParams {
+		return fmt.Errorf("request has %d query parameters (max %d)", n, cfg.MaxQueryParams)
+	}
+	return nil
+}
+
+// requestHeaders returns the request headers, keeping only the first
+// max_headers of them when the request is being truncated.
+func requestHeaders(c fiber.Ctx) map[string][]string {
+	limits, ok := c.Locals(requestLimitsKey{}).(requestLimits)
+	if !ok || limits.headers == 0 {
+		return c.GetReqHeaders()
+	}
+
+	headers := map[string][]string{}
+	n := 0
+	for k, v := range c.Request().Header.All() {
+		if n == limits.headers {
+			break
+		}
+		headers[string(k)] = append(headers[string(k)], string(v))
+		n++
+	}
+	return headers
+}
+
+// requestQueries returns the query parameters, keeping only the first
+// max_query_params of them when the request is being truncated.
+func requestQueries(c fiber.Ctx) map[string]string {
+	limits, ok := c.Locals(requestLimitsKey{}).(requestLimits)
+	if !ok || limits.query == 0 {
+		return c.Queries()
+	}
+
+	queries := map[string]string{}
+	n := 0
+	for k, v := range c.RequestCtx().QueryArgs().All() {
+		if n == limits.query {
+			break
+		}
+		queries[string(k)] = string(v)
+		n++
+	}
+	return queries
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v3"
+)
+
+// LiveConfig serves a WebSocket admin endpoint that broadcasts every
+// output record to connected clients, e.g. for a live debug dashboard.
+type LiveConfig struct {
+	Enabled      bool   `json:"enabled" yaml:"enabled"`
+	Path         string `json:"path" yaml:"path"`
+	ClientBuffer int    `json:"client_buffer" yaml:"client_buffer"`
+}
+
+// liveHub fans records out to WebSocket clients. Each client has its own
+// bounded queue; records for a client whose queue is full are dropped so
+// a slow client never holds up the webhook pipeline.
+type liveHub struct {
+	mu      sync.Mutex
+	clients map[*liveClient]struct{}
+	buffer  int
+	logger  *slog.Logger
+}
+
+type liveClient struct {
+	send    chan []byte
+	dropped int
+}
+
+func newLiveHub(buffer int, logger *slog.Logger) *liveHub {
+	return &liveHub{clients: map[*liveClient]struct{}{}, buffer: buffer, logger: logger}
+}
+
+// Broadcast queues record for every connected client. The record is only
+// encoded when someone is listening.
+func (h *liveHub) Broadcast(record any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.clients) == 0 {
+		return
+	}
+	msg, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	for client := range h.clients {
+		select {
+		case client.send <- msg:
+		default:
+			client.dropped++
+		}
+	}
+}
+
+func (h *liveHub) add() *liveClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client := &liveClient{send: make(chan []byte, h.buffer)}
+	h.clients[client] = struct{}{}
+	return client
+}
+
+func (h *liveHub) remove(client *liveClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.send)
+		h.logger.Debug("live client disconnected", "dropped", client.dropped)
+	}
+}
+
+// Close disconnects every client.
+func (h *liveHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		delete(h.clients, client)
+		close(client.send)
+	}
+}
+
+// handler upgrades the request to a WebSocket and streams records to it
+// as JSON text messages until either side closes.
+func (h *liveHub) handler() fiber.Handler {
+	upgrader := websocket.FastHTTPUpgrader{}
+	return func(c fiber.Ctx) error {
+		if !websocket.FastHTTPIsWebSocketUpgrade(c.RequestCtx()) {
+			return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{"error": "websocket upgrade required"})
+		}
+		return upgrader.Upgrade(c.RequestCtx(), func(conn *websocket.Conn) {
+			defer conn.Close()
+
+			client := h.add()
+			defer h.remove(client)
+
+			// Clients only listen; reading notices when they go away.
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+
+			for {
+				select {
+				case msg, ok := <-client.send:
+					if !ok {
+						_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+						return
+					}
+					if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+						return
+					}
+				case <-closed:
+					return
+				}
+			}
+		})
+	}
+}
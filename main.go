@@ -1,55 +1,337 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v3"
+	recoverer "github.com/gofiber/fiber/v3/middleware/recover"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
 )
 
 type Source string
 
 const (
-	SourceBody    Source = "body"
-	SourceHeaders Source = "headers"
-	SourceQuery   Source = "query"
-	SourceParams  Source = "params"
-	SourceMethod  Source = "method"
-	SourcePath    Source = "path"
-	SourceIP      Source = "ip"
+	SourceBody        Source = "body"
+	SourceHeaders     Source = "headers"
+	SourceQuery       Source = "query"
+	SourceQueryString Source = "query_string"
+	SourceParams      Source = "params"
+	SourceMethod      Source = "method"
+	SourcePath        Source = "path"
+	SourceIP          Source = "ip"
+	SourceRequestID   Source = "request_id"
+	SourceAuth        Source = "auth"
+	SourceBodySize    Source = "body_size"
+	SourceTrailers    Source = "trailers"
+	SourceSeq         Source = "seq"
+	SourceJWT         Source = "jwt"
+	SourceHTTPVersion Source = "http_version"
+	SourceRequestLine Source = "request_line"
+	SourceTLSInfo     Source = "tls_info"
+)
+
+// sources lists every supported source, in the order they are documented.
+var sources = []Source{
+	SourceBody, SourceHeaders, SourceQuery, SourceQueryString, SourceParams,
+	SourceMethod, SourcePath, SourceIP, SourceRequestID, SourceBodySize,
+	SourceHTTPVersion, SourceRequestLine, SourceTLSInfo, SourceJWT, SourceSeq,
+	SourceTrailers, SourceAuth,
+}
+
+// UnmarshalText accepts source names in any case, so "Body" or "HEADERS"
+// in a config file mean the same as "body" and "headers".
+func (s *Source) UnmarshalText(text []byte) error {
+	*s = Source(strings.ToLower(strings.TrimSpace(string(text))))
+	return nil
+}
+
+func (s Source) known() bool {
+	return slices.Contains(sources, s)
+}
+
+func sourceNames() string {
+	names := make([]string, len(sources))
+	for i, s := range sources {
+		names[i] = string(s)
+	}
+	return strings.Join(names, ", ")
+}
+
+const requestPrettyParam = "_pretty"
+
+type RootMergeStrategy string
+
+const (
+	RootMergeError RootMergeStrategy = "error"
+	RootMergeFirst RootMergeStrategy = "first"
+	RootMergeLast  RootMergeStrategy = "last"
+)
+
+// KeyCollisionPolicy resolves keys that collide at runtime, after rename
+// transforms or key_case normalization.
+type KeyCollisionPolicy string
+
+const (
+	KeyCollisionError KeyCollisionPolicy = "error"
+	KeyCollisionFirst KeyCollisionPolicy = "first"
+	KeyCollisionLast  KeyCollisionPolicy = "last"
+)
+
+type HashAlgorithm string
+
+const (
+	HashSHA256 HashAlgorithm = "sha256"
+	HashSHA1   HashAlgorithm = "sha1"
+	HashMD5    HashAlgorithm = "md5"
+)
+
+type OnErrorPolicy string
+
+const (
+	OnErrorFail    OnErrorPolicy = "fail"
+	OnErrorSkip    OnErrorPolicy = "skip"
+	OnErrorDefault OnErrorPolicy = "default"
+)
+
+type MergeQueryPolicy string
+
+const (
+	MergeQueryPreferBody  MergeQueryPolicy = "prefer_body"
+	MergeQueryPreferQuery MergeQueryPolicy = "prefer_query"
+)
+
+type NonUTF8Policy string
+
+const (
+	NonUTF8Base64  NonUTF8Policy = "base64"
+	NonUTF8Replace NonUTF8Policy = "replace"
+	NonUTF8Error   NonUTF8Policy = "error"
+)
+
+type EmptyOutputPolicy string
+
+const (
+	EmptyOutputEmit  EmptyOutputPolicy = "emit"
+	EmptyOutputSkip  EmptyOutputPolicy = "skip"
+	EmptyOutputError EmptyOutputPolicy = "error"
+)
+
+type OutputPrefixMode string
+
+const (
+	OutputPrefixText  OutputPrefixMode = "text"
+	OutputPrefixField OutputPrefixMode = "field"
 )
 
 type FieldMapping struct {
-	From Source `json:"from" yaml:"from"`
-	To   string `json:"to" yaml:"to"`
-	Root bool   `json:"root" yaml:"root"`
+	From            Source           `json:"from" yaml:"from"`
+	To              string           `json:"to" yaml:"to"`
+	Root            bool             `json:"root" yaml:"root"`
+	ParseJSON       []string         `json:"parse_json" yaml:"parse_json"`
+	ParseJSONStrict bool             `json:"parse_json_strict" yaml:"parse_json_strict"`
+	Include         []string         `json:"include" yaml:"include"`
+	IncludeDefaults map[string]any   `json:"include_defaults" yaml:"include_defaults"`
+	Keys            []string         `json:"keys" yaml:"keys"`
+	MergeQuery      MergeQueryPolicy `json:"merge_query" yaml:"merge_query"`
+	Transforms      []TransformStep  `json:"transforms" yaml:"transforms"`
+	OnError         OnErrorPolicy    `json:"on_error" yaml:"on_error"`
+	Default         any              `json:"default" yaml:"default"`
+	Prefix          string           `json:"prefix" yaml:"prefix"`
+	Suffix          string           `json:"suffix" yaml:"suffix"`
+	OnNonString     NonStringPolicy  `json:"on_non_string" yaml:"on_non_string"`
+	// Merge builds the value as an object from several sub-mappings,
+	// instead of reading From.
+	Merge []FieldMapping `json:"merge" yaml:"merge"`
+
+	// pipeline holds the built transforms and keyCollision the
+	// on_key_collision policy they apply; see compileMappings.
+	pipeline     []transform
+	keyCollision KeyCollisionPolicy
+}
+
+// EchoRule copies a request header or query parameter into a response
+// header, for providers that expect a challenge token echoed back.
+type EchoRule struct {
+	From   Source `json:"from" yaml:"from"`
+	Name   string `json:"name" yaml:"name"`
+	Header string `json:"header" yaml:"header"`
 }
 
 type Config struct {
-	Port      int            `json:"port" yaml:"port"`
-	Route     string         `json:"route" yaml:"route"`
-	Pretty    bool           `json:"pretty" yaml:"pretty"`
-	LogJSON   bool           `json:"log_json" yaml:"log_json"`
-	LogLevel  string         `json:"log_level" yaml:"log_level"`
-	AckStatus int            `json:"ack_status" yaml:"ack_status"`
-	AckBody   map[string]any `json:"ack_body" yaml:"ack_body"`
-	Mappings  []FieldMapping `json:"mappings" yaml:"mappings"`
+	Port               int                  `json:"port" yaml:"port"`
+	BindAddress        string               `json:"bind_address" yaml:"bind_address"`
+	Route              string               `json:"route" yaml:"route"`
+	BasePath           string               `json:"base_path" yaml:"base_path"`
+	Pretty             bool                 `json:"pretty" yaml:"pretty"`
+	AllowRequestPretty bool                 `json:"allow_request_pretty" yaml:"allow_request_pretty"`
+	DebugTee           bool                 `json:"debug_tee" yaml:"debug_tee"`
+	LogJSON            bool                 `json:"log_json" yaml:"log_json"`
+	LogLevel           string               `json:"log_level" yaml:"log_level"`
+	RequestIDHeader    string               `json:"request_id_header" yaml:"request_id_header"`
+	AckStatus          int                  `json:"ack_status" yaml:"ack_status"`
+	AckBody            map[string]any       `json:"ack_body" yaml:"ack_body"`
+	AckEchoOutput      bool                 `json:"ack_echo_output" yaml:"ack_echo_output"`
+	AckXML             bool                 `json:"ack_xml" yaml:"ack_xml"`
+	AckDefaultFormat   AckFormat            `json:"ack_default_format" yaml:"ack_default_format"`
+	AckDelay           Duration             `json:"ack_delay" yaml:"ack_delay"`
+	AckDelayJitter     Duration             `json:"ack_delay_jitter" yaml:"ack_delay_jitter"`
+	RootMergeStrategy  RootMergeStrategy    `json:"root_merge_strategy" yaml:"root_merge_strategy"`
+	KeyCase            KeyCase              `json:"key_case" yaml:"key_case"`
+	OnKeyCollision     KeyCollisionPolicy   `json:"on_key_collision" yaml:"on_key_collision"`
+	NonUTF8Policy      NonUTF8Policy        `json:"non_utf8_policy" yaml:"non_utf8_policy"`
+	CaptureParseErrors bool                 `json:"capture_parse_errors" yaml:"capture_parse_errors"`
+	RequireJSONBody    bool                 `json:"require_json_body" yaml:"require_json_body"`
+	MaxJSONDepth       int                  `json:"max_json_depth" yaml:"max_json_depth"`
+	MaxHeaders         int                  `json:"max_headers" yaml:"max_headers"`
+	MaxQueryParams     int                  `json:"max_query_params" yaml:"max_query_params"`
+	OnLimitExceeded    LimitPolicy          `json:"on_limit_exceeded" yaml:"on_limit_exceeded"`
+	Compression        CompressionConfig    `json:"compression" yaml:"compression"`
+	CORS               CORSConfig           `json:"cors" yaml:"cors"`
+	Server             ServerConfig         `json:"server" yaml:"server"`
+	MaxInFlight        int                  `json:"max_in_flight" yaml:"max_in_flight"`
+	ParseConcurrency   int                  `json:"parse_concurrency" yaml:"parse_concurrency"`
+	Passthrough        bool                 `json:"passthrough" yaml:"passthrough"`
+	AckFirst           bool                 `json:"ack_first" yaml:"ack_first"`
+	BatchPath          string               `json:"batch_path" yaml:"batch_path"`
+	RequestLogFields   []string             `json:"request_log_fields" yaml:"request_log_fields"`
+	AllowedBodyKeys    []string             `json:"allowed_body_keys" yaml:"allowed_body_keys"`
+	UnknownKeys        UnknownKeysPolicy    `json:"unknown_keys" yaml:"unknown_keys"`
+	ParseBusyPolicy    ParseBusyPolicy      `json:"parse_busy_policy" yaml:"parse_busy_policy"`
+	Rejections         RejectionsConfig     `json:"rejections" yaml:"rejections"`
+	Metrics            MetricsConfig        `json:"metrics" yaml:"metrics"`
+	Admin              AdminConfig          `json:"admin" yaml:"admin"`
+	Recent             RecentConfig         `json:"recent" yaml:"recent"`
+	ConfigEndpoint     ConfigEndpointConfig `json:"config_endpoint" yaml:"config_endpoint"`
+	DebugInfo          DebugInfoConfig      `json:"debug_info" yaml:"debug_info"`
+	Live               LiveConfig           `json:"live" yaml:"live"`
+	Output             OutputConfig         `json:"output" yaml:"output"`
+	OnEmptyOutput      EmptyOutputPolicy    `json:"on_empty_output" yaml:"on_empty_output"`
+	Explode            string               `json:"explode" yaml:"explode"`
+	DurationField      string               `json:"duration_field" yaml:"duration_field"`
+	BodyHashField      string               `json:"body_hash_field" yaml:"body_hash_field"`
+	BodyHashAlgorithm  HashAlgorithm        `json:"body_hash_algorithm" yaml:"body_hash_algorithm"`
+	GeoIP              GeoIPConfig          `json:"geoip" yaml:"geoip"`
+	DeadLetter         DeadLetterConfig     `json:"dead_letter" yaml:"dead_letter"`
+	OutputPrefix       string               `json:"output_prefix" yaml:"output_prefix"`
+	OutputPrefixMode   OutputPrefixMode     `json:"output_prefix_mode" yaml:"output_prefix_mode"`
+	OutputPrefixField  string               `json:"output_prefix_field" yaml:"output_prefix_field"`
+	OutputWrapper      string               `json:"output_wrapper" yaml:"output_wrapper"`
+	OutputMeta         map[string]any       `json:"output_meta" yaml:"output_meta"`
+	RedactPatterns     []string             `json:"redact_patterns" yaml:"redact_patterns"`
+	MaxStringLen       int                  `json:"max_string_len" yaml:"max_string_len"`
+	TruncationMarker   string               `json:"truncation_marker" yaml:"truncation_marker"`
+	Envelope           EnvelopeConfig       `json:"envelope" yaml:"envelope"`
+	Echo               []EchoRule           `json:"echo" yaml:"echo"`
+	MetaVerify         MetaVerifyConfig     `json:"meta_verify" yaml:"meta_verify"`
+	SlackVerify        SlackVerifyConfig    `json:"slack_verify" yaml:"slack_verify"`
+	GitHubVerify       GitHubVerifyConfig   `json:"github_verify" yaml:"github_verify"`
+	JWT                JWTConfig            `json:"jwt" yaml:"jwt"`
+	Routes             []RouteConfig        `json:"routes" yaml:"routes"`
+	ProviderRoute      RouteConfig          `json:"provider_route" yaml:"provider_route"`
+	Providers          []ProviderConfig     `json:"providers" yaml:"providers"`
+	Protobuf           ProtobufConfig       `json:"protobuf" yaml:"protobuf"`
+	Mappings           []FieldMapping       `json:"mappings" yaml:"mappings"`
 }
 
 func defaultConfig() Config {
 	return Config{
-		Port:      8080,
-		Route:     "/",
-		Pretty:    false,
-		LogJSON:   true,
-		LogLevel:  "info",
-		AckStatus: 200,
+		Port:            8080,
+		Route:           "/",
+		Pretty:          false,
+		LogJSON:         true,
+		LogLevel:        "info",
+		RequestIDHeader: fiber.HeaderXRequestID,
+		AckStatus:       200,
 		AckBody: map[string]any{
 			"ok": true,
 		},
+		AckDefaultFormat:  AckFormatJSON,
+		RootMergeStrategy: RootMergeError,
+		OnKeyCollision:    KeyCollisionError,
+		KeyCase:           KeyCaseAsIs,
+		NonUTF8Policy:     NonUTF8Replace,
+		OnEmptyOutput:     EmptyOutputEmit,
+		OnLimitExceeded:   LimitTruncate,
+		BodyHashAlgorithm: HashSHA256,
+		TruncationMarker:  "…(truncated {n} bytes)",
+		ParseBusyPolicy:   ParseBusyWait,
+		UnknownKeys:       UnknownKeysAllow,
+		OutputPrefixMode:  OutputPrefixText,
+		Compression: CompressionConfig{
+			Level:   "default",
+			MinSize: 1024,
+		},
+		Server:     defaultServerConfig(),
+		Rejections: defaultRejectionsConfig(),
+		Envelope: EnvelopeConfig{
+			DataField: "data",
+			Fields:    []string{"received_at", "source_ip"},
+		},
+		GeoIP: GeoIPConfig{
+			Field: "geo",
+		},
+		Metrics: MetricsConfig{
+			Path: "/metrics",
+		},
+		Recent: RecentConfig{
+			Path: "/recent",
+		},
+		ConfigEndpoint: ConfigEndpointConfig{
+			Path: "/config",
+		},
+		DebugInfo: DebugInfoConfig{
+			Path: "/debug/info",
+		},
+		ProviderRoute: RouteConfig{
+			Path: "/hooks/" + providerPlaceholder,
+		},
+		Live: LiveConfig{
+			Path:         "/live",
+			ClientBuffer: 64,
+		},
+		SlackVerify: SlackVerifyConfig{
+			Tolerance: Duration(5 * time.Minute),
+		},
+		JWT: JWTConfig{
+			Header: fiber.HeaderAuthorization,
+		},
+		Output: OutputConfig{
+			Mode:          OutputStdout,
+			Format:        OutputFormatJSON,
+			FlushInterval: Duration(time.Second),
+			Window:        Duration(time.Minute),
+			BatchSize:     500,
+			MaxOpenFiles:  64,
+			IdleTimeout:   Duration(5 * time.Minute),
+			QueueSize:     1024,
+			PausePolicy:   PauseBuffer,
+			PauseBuffer:   10000,
+			MaxRecords:    10000,
+		},
 		Mappings: []FieldMapping{
 			{From: SourceBody, To: "body"},
 			{From: SourceHeaders, To: "headers"},
@@ -63,7 +345,9 @@ func defaultConfig() Config {
 }
 
 func main() {
+	started := time.Now()
 	configPath := flag.String("config", "config.yaml", "Path to YAML or JSON config file")
+	requireSinks := flag.Bool("require-sinks", false, "Exit if the output sink preflight check fails instead of warning")
 	flag.Parse()
 
 	cfg, err := loadConfig(*configPath)
@@ -76,52 +360,446 @@ func main() {
 		os.Exit(1)
 	}
 
-	logger, err := newLogger(cfg.LogJSON, cfg.LogLevel)
+	// Every write to stdout and stderr goes through one lock per stream,
+	// so concurrent records and log lines never interleave.
+	stdout := &lockedWriter{w: os.Stdout}
+	stderr := &lockedWriter{w: os.Stderr}
+
+	// Service logs share stdout with the output stream unless that stream
+	// is gzipped or MessagePack, where interleaved plain-text lines would
+	// corrupt it.
+	logOutput := stdout
+	if cfg.Output.Gzip || cfg.Output.Format == OutputFormatMsgpack {
+		logOutput = stderr
+	}
+	logger, err := newLogger(logOutput, cfg.LogJSON, cfg.LogLevel)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "invalid log configuration: %v\n", err)
 		os.Exit(1)
 	}
 
-	app := fiber.New(fiber.Config{
-		ServerHeader: "wh-logger",
-		AppName:      "Webhook Logger",
-	})
+	logger.Info("starting", featureSummary(cfg)...)
+
+	decodeBody, err := newBodyDecoder(cfg)
+	if err != nil {
+		logger.Error("failed to load protobuf descriptor", "error", err)
+		os.Exit(1)
+	}
+
+	redactPatterns, err := compileRedactPatterns(cfg.RedactPatterns)
+	if err != nil {
+		logger.Error("invalid redact patterns", "error", err)
+		os.Exit(1)
+	}
+	truncator := stringTruncator{limit: cfg.MaxStringLen, marker: cfg.TruncationMarker}
+
+	var geo *geoIP
+	if cfg.GeoIP.enabled() {
+		if geo, err = newGeoIP(cfg.GeoIP); err != nil {
+			logger.Error("failed to load geoip database", "error", err)
+			os.Exit(1)
+		}
+		defer geo.Close()
+	}
 
-	app.All(cfg.Route, func(c fiber.Ctx) error {
-		output, err := buildOutput(c, cfg.Mappings)
+	dead, err := newDeadLetter(cfg.DeadLetter)
+	if err != nil {
+		logger.Error("failed to open dead letter output", "error", err)
+		os.Exit(1)
+	}
+
+	sink, err := newOutputSink(cfg.Output, stdout, dead, logger)
+	if err != nil {
+		logger.Error("failed to open output", "error", err)
+		os.Exit(1)
+	}
+	pausable := newPausableSink(sink, cfg.Output, logger)
+	sink = pausable
+	if err := preflightSink(sink); err != nil {
+		if *requireSinks {
+			logger.Error("output preflight failed", "output_mode", cfg.Output.Mode, "error", err)
+			_ = sink.Close()
+			os.Exit(1)
+		}
+		logger.Warn("output preflight failed", "output_mode", cfg.Output.Mode, "error", err)
+	}
+
+	// deadLetterRequest captures a request rejected for its content.
+	deadLetterRequest := func(c fiber.Ctx, raw []byte, reason string, err error) {
+		if err := dead.Write(c, raw, reason, err); err != nil {
+			logger.Error("failed to write dead letter", "error", err, "request_id", requestid.FromContext(c))
+		}
+	}
+
+	parseLimit := newParseLimiter(cfg.ParseConcurrency, cfg.ParseBusyPolicy)
+	async := &asyncOutput{sink: sink, dead: dead, logger: logger}
+
+	app := fiber.New(newFiberConfig(cfg.Server, cfg.Rejections, logger))
+
+	app.Use(recoverer.New(recoverer.Config{
+		EnableStackTrace: true,
+		StackTraceHandler: func(c fiber.Ctx, e any) {
+			logger.Error("recovered from panic",
+				"panic", fmt.Sprint(e),
+				"method", c.Method(),
+				"path", c.Path(),
+				"stack", string(debug.Stack()),
+			)
+		},
+	}))
+
+	app.Use(requestid.New(requestid.Config{
+		Header: cfg.RequestIDHeader,
+	}))
+
+	// debug_tee mirrors records to stderr, pretty-printed for people.
+	debugTee := &writerSink{w: stderr}
+
+	// Every endpoint lives under base_path; an empty prefix leaves paths as is.
+	router := app.Group(cfg.BasePath)
+
+	stats := &metrics{}
+	if cfg.Metrics.Enabled {
+		router.Get(cfg.Metrics.Path, stats.handler)
+	}
+
+	var recent *recentBuffer
+	if cfg.Recent.Size > 0 {
+		recent = newRecentBuffer(cfg.Recent.Size)
+		router.Get(cfg.Recent.Path, requireAdminToken(cfg.Admin.Token, cfg.Rejections.Auth, logger), func(c fiber.Ctx) error {
+			return c.JSON(recent.Snapshot())
+		})
+	}
+	// draining is set once shutdown starts; see drainOnShutdown.
+	var draining atomic.Bool
+
+	var live *liveHub
+	if cfg.Live.Enabled {
+		live = newLiveHub(cfg.Live.ClientBuffer, logger)
+		router.Get(cfg.Live.Path, requireAdminToken(cfg.Admin.Token, cfg.Rejections.Auth, logger), live.handler())
+	}
+	if cfg.ConfigEndpoint.Enabled {
+		masked := maskedConfig(cfg)
+		router.Get(cfg.ConfigEndpoint.Path, requireAdminToken(cfg.Admin.Token, cfg.Rejections.Auth, logger), func(c fiber.Ctx) error {
+			return c.JSON(masked)
+		})
+	}
+	if cfg.DebugInfo.Enabled {
+		router.Get(cfg.DebugInfo.Path, requireAdminToken(cfg.Admin.Token, cfg.Rejections.Auth, logger), debugInfoHandler(cfg, stats, started))
+	}
+
+	newHandler := func(route RouteConfig, logger *slog.Logger) fiber.Handler {
+		return func(c fiber.Ctx) error {
+			start := time.Now()
+
+			if handled, err := handleMetaVerify(c, cfg.MetaVerify, logger); handled {
+				return err
+			}
+
+			pretty := requestPretty(c, cfg)
+
+			body := newRequestBody(c, decodeBody)
+
+			if reason, err := verifyRequest(c, body.Raw(), cfg, route, time.Now()); err != nil {
+				deadLetterRequest(c, body.Raw(), reason, err)
+				return cfg.Rejections.Signature.reject(c, logger, reason, err)
+			}
+
+			if err := checkRequestLimits(c, cfg); err != nil {
+				if cfg.OnLimitExceeded == LimitReject {
+					deadLetterRequest(c, body.Raw(), "too many fields", err)
+					logRejection(logger, c, "too many fields", fiber.StatusBadRequest, err)
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+				}
+				logger.Warn("truncating request", "error", err, "request_id", requestid.FromContext(c))
+				c.Locals(requestLimitsKey{}, requestLimits{headers: cfg.MaxHeaders, query: cfg.MaxQueryParams})
+			}
+
+			releaseParse, ok := parseLimit.acquire(cfg, route)
+			if !ok {
+				return cfg.Rejections.ParseBusy.reject(c, logger, "parse busy", nil)
+			}
+			defer releaseParse()
+
+			if cfg.RequireJSONBody {
+				if err := checkJSONBody(body.Raw()); err != nil {
+					deadLetterRequest(c, body.Raw(), "invalid body", err)
+					logRejection(logger, c, "invalid body", fiber.StatusBadRequest, err)
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+				}
+			}
+
+			if cfg.Passthrough {
+				prefix := ""
+				if cfg.OutputPrefixMode == OutputPrefixText {
+					prefix = cfg.OutputPrefix
+				}
+				releaseParse()
+				line := passthroughLine(body.Raw(), prefix)
+				if route.ackFirst() {
+					async.write([][]byte{line}, nil, dead.record(c, body.Raw(), "output", nil), strings.Clone(requestid.FromContext(c)))
+				} else if err := sink.Write(line); err != nil {
+					logger.Error("failed to write output", "error", err, "request_id", requestid.FromContext(c))
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to write output"})
+				}
+				if cfg.DebugTee {
+					_ = debugTee.Write(line)
+				}
+				waitAckDelay(c.RequestCtx(), time.Duration(cfg.AckDelay), time.Duration(cfg.AckDelayJitter))
+				applyEcho(c, cfg.Echo)
+				return sendAck(c, cfg, cfg.AckBody)
+			}
+
+			linePrefix := ""
+			if cfg.OutputPrefix != "" && cfg.OutputPrefixMode != OutputPrefixField {
+				linePrefix = cfg.OutputPrefix
+			}
+			wrapper, meta := cfg.OutputWrapper, cfg.OutputMeta
+			if cfg.Envelope.Enabled {
+				wrapper, meta = cfg.Envelope.DataField, envelopeMeta(c, cfg, start)
+			}
+
+			// A batched request is mapped once per element; the records of
+			// all elements are written only once every element has mapped.
+			bodies, batched := batchBodies(body, route.BatchPath)
+			outputs := make([]any, 0, len(bodies))
+			var records []any
+			for _, item := range bodies {
+				if err := checkBodyKeys(item, cfg.AllowedBodyKeys, cfg.UnknownKeys); err != nil {
+					deadLetterRequest(c, body.Raw(), "unknown keys", err)
+					logRejection(logger, c, "unknown keys", fiber.StatusBadRequest, err)
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+				}
+
+				output, err := buildOutput(c, item, route.Mappings, cfg.RootMergeStrategy)
+				if err == nil {
+					output, err = applyKeyCase(output, cfg.KeyCase, cfg.OnKeyCollision)
+				}
+				if err != nil {
+					deadLetterRequest(c, body.Raw(), "build_output", err)
+					logRejection(logger, c, "build_output", fiber.StatusBadRequest, err)
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+				}
+
+				empty := isEmptyOutput(output)
+				if empty && cfg.OnEmptyOutput == EmptyOutputError {
+					deadLetterRequest(c, body.Raw(), "empty output", nil)
+					logRejection(logger, c, "empty output", fiber.StatusBadRequest, nil)
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mappings produced no output"})
+				}
+
+				if geo != nil {
+					injectField(output, cfg.GeoIP.Field, geo.lookup(c.IP()))
+				}
+				if len(redactPatterns) > 0 {
+					output = applyRedactPatterns(output, redactPatterns, 0)
+				}
+				output = truncator.apply(output, 0)
+				if cfg.BodyHashField != "" {
+					injectField(output, cfg.BodyHashField, bodyHash(body.Raw(), cfg.BodyHashAlgorithm))
+				}
+				if cfg.DurationField != "" {
+					injectField(output, cfg.DurationField, float64(time.Since(start))/float64(time.Millisecond))
+				}
+				if cfg.OutputPrefix != "" && cfg.OutputPrefixMode == OutputPrefixField {
+					injectField(output, cfg.OutputPrefixField, cfg.OutputPrefix)
+				}
+
+				outputs = append(outputs, output)
+				if empty && cfg.OnEmptyOutput == EmptyOutputSkip {
+					continue
+				}
+				for _, record := range explodeOutput(output, cfg.Explode) {
+					records = append(records, wrapOutput(record, wrapper, meta))
+				}
+			}
+			// Every body read is done; encoding and writing do not hold the
+			// parse slot.
+			releaseParse()
+
+			// ack_first routes write after the ack, from lines encoded now
+			// while the request is still valid. Partitioned writes also
+			// finish after the request, so both carry its dead-letter
+			// record, captured now.
+			var (
+				lines  [][]byte
+				keys   []string
+				letter map[string]any
+			)
+			if len(records) > 0 && (route.ackFirst() || cfg.Output.Workers > 0) {
+				letter = dead.record(c, body.Raw(), "output", nil)
+			}
+			for _, record := range records {
+				var (
+					line []byte
+					key  string
+					err  error
+				)
+				if cfg.Output.Format == OutputFormatMsgpack {
+					line, err = encodeMsgpack(record)
+				} else {
+					line, err = encodeOutput(record, pretty, linePrefix)
+				}
+				if cfg.Output.Workers > 0 {
+					key = partitionKey(record, cfg.Output.PartitionKey)
+				}
+				if err == nil && !route.ackFirst() {
+					err = writeOutputLine(sink, line, key, letter)
+				}
+				if err != nil {
+					logger.Error("failed to write output", "error", err, "request_id", requestid.FromContext(c))
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to write output"})
+				}
+				if cfg.DebugTee {
+					_ = printOutput(debugTee, record, true, linePrefix)
+				}
+				if recent != nil {
+					recent.Add(record)
+				}
+				if live != nil {
+					live.Broadcast(record)
+				}
+				if route.ackFirst() {
+					lines = append(lines, line)
+					keys = append(keys, key)
+				}
+			}
+			if len(lines) > 0 {
+				async.write(lines, keys, letter, strings.Clone(requestid.FromContext(c)))
+			}
+
+			logger.Debug("handled webhook", "method", c.Method(), "records", len(records), "request_id", requestid.FromContext(c))
+
+			waitAckDelay(c.RequestCtx(), time.Duration(cfg.AckDelay), time.Duration(cfg.AckDelayJitter))
+			applyEcho(c, cfg.Echo)
+			if cfg.AckEchoOutput {
+				// A batch echoes the output of every element, in order.
+				if batched {
+					return sendAck(c, cfg, outputs)
+				}
+				return sendAck(c, cfg, outputs[0])
+			}
+			return sendAck(c, cfg, cfg.AckBody)
+		}
+	}
+
+	// max_in_flight is a process-wide cap, so all routes share one limiter.
+	inFlight := limitInFlight(cfg.MaxInFlight, stats, cfg.Rejections.InFlight, logger)
+	for _, route := range cfg.routes() {
+		// Each route logs at its own level, falling back to log_level.
+		routeLogger, err := newLogger(logOutput, cfg.LogJSON, route.LogLevel)
 		if err != nil {
-			logger.Error("failed to build output", "error", err)
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			logger.Error("invalid route log level", "route", route.Path, "error", err)
+			os.Exit(1)
+		}
+		if route.Mappings, err = compileMappings(route.Mappings, cfg.OnKeyCollision); err != nil {
+			logger.Error("invalid route mappings", "route", route.Path, "error", err)
+			os.Exit(1)
 		}
 
-		if err := printOutput(output, cfg.Pretty); err != nil {
-			logger.Error("failed to write output", "error", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to write output"})
+		var handlers []any
+		if len(cfg.RequestLogFields) > 0 {
+			handlers = append(handlers, accessLog(cfg.RequestLogFields, routeLogger.With("route", route.Path)))
+		}
+		if cfg.CORS.Enabled {
+			handlers = append(handlers, newCORS(cfg.CORS))
 		}
+		handlers = append(handlers, rejectWhileDraining(&draining, cfg.Rejections.Draining, routeLogger))
+		handlers = append(handlers, inFlight)
+		if cfg.Server.RequireContentLength {
+			handlers = append(handlers, requireContentLength(routeLogger))
+		}
+		if cfg.Compression.Enabled {
+			handlers = append(handlers, newAckCompression(cfg.Compression))
+		}
+		handlers = append(handlers, newHandler(route, routeLogger.With("route", route.Path)))
+		router.All(route.Path, handlers[0], handlers[1:]...)
+	}
 
-		return c.Status(cfg.AckStatus).JSON(cfg.AckBody)
-	})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	handlePauseSignals(ctx, pausable)
 
-	addr := fmt.Sprintf(":%d", cfg.Port)
-	logger.Debug("listening", "address", addr, "route", cfg.Route)
-	if err := app.Listen(addr, fiber.ListenConfig{
+	ln, err := activationListener()
+	if err != nil {
+		logger.Error("failed to use activation socket", "error", err)
+		os.Exit(1)
+	}
+	listenCfg := fiber.ListenConfig{
 		DisableStartupMessage: true,
-	}); err != nil {
-		logger.Error("server exited", "error", err)
+		GracefulContext:       drainOnShutdown(ctx, &draining, time.Duration(cfg.Server.DrainDelay), logger),
+		ShutdownTimeout:       10 * time.Second,
+	}
+	var listenErr error
+	if ln != nil {
+		logger.Info("using activation socket", "address", ln.Addr().String(), "routes", len(cfg.routes()))
+		listenErr = app.Listener(ln, listenCfg)
+	} else {
+		addr, network := listenAddress(cfg.BindAddress, cfg.Port)
+		logger.Debug("listening", "address", addr, "network", network, "routes", len(cfg.routes()))
+		listenCfg.ListenerNetwork = network
+		listenErr = app.Listen(addr, listenCfg)
+	}
+	if live != nil {
+		live.Close()
+	}
+	async.Wait()
+	if err := sink.Close(); err != nil {
+		logger.Error("failed to close output", "error", err)
+	}
+	if err := dead.Close(); err != nil {
+		logger.Error("failed to close dead letter output", "error", err)
+	}
+	if listenErr != nil {
+		logger.Error("server exited", "error", listenErr)
 		os.Exit(1)
 	}
 }
 
-func newLogger(jsonOutput bool, level string) (*slog.Logger, error) {
+// featureSummary lists which optional features the resolved config turns
+// on, as slog key/value pairs. It reports only whether secrets are set,
+// never their values.
+func featureSummary(cfg Config) []any {
+	return []any{
+		"port", cfg.Port,
+		"routes", len(cfg.routes()),
+		"output_mode", cfg.Output.Mode,
+		"output_gzip", cfg.Output.Gzip,
+		"mappings", len(cfg.Mappings),
+		"meta_verify", cfg.MetaVerify.VerifyToken != "",
+		"slack_verify", slices.ContainsFunc(cfg.routes(), func(r RouteConfig) bool { return r.SlackVerify.SigningSecret != "" }),
+		"github_verify", slices.ContainsFunc(cfg.routes(), func(r RouteConfig) bool { return r.GitHubVerify.Secret != "" }),
+		"jwt_verify", cfg.JWT.verifying(),
+		"admin_token", cfg.Admin.Token != "",
+		"recent", cfg.Recent.Size > 0,
+		"config_endpoint", cfg.ConfigEndpoint.Enabled,
+		"debug_info", cfg.DebugInfo.Enabled,
+		"live", cfg.Live.Enabled,
+		"metrics", cfg.Metrics.Enabled,
+		"compression", cfg.Compression.Enabled,
+		"max_in_flight", cfg.MaxInFlight,
+		"parse_concurrency", cfg.ParseConcurrency,
+		"passthrough", cfg.Passthrough,
+		"protobuf", cfg.Protobuf.enabled(),
+		"geoip", cfg.GeoIP.enabled(),
+		"dead_letter", cfg.DeadLetter.Path != "",
+		"explode", cfg.Explode != "",
+		"key_case", cfg.KeyCase,
+		"ack_echo_output", cfg.AckEchoOutput,
+		"debug_tee", cfg.DebugTee,
+	}
+}
+
+func newLogger(w io.Writer, jsonOutput bool, level string) (*slog.Logger, error) {
 	logLevel, err := parseLogLevel(level)
 	if err != nil {
 		return nil, err
 	}
 	opts := &slog.HandlerOptions{Level: logLevel}
 	if jsonOutput {
-		return slog.New(slog.NewJSONHandler(os.Stdout, opts)), nil
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
 	}
-	return slog.New(slog.NewTextHandler(os.Stdout, opts)), nil
+	return slog.New(slog.NewTextHandler(w, opts)), nil
 }
 
 func parseLogLevel(level string) (slog.Level, error) {
@@ -139,7 +817,7 @@ func parseLogLevel(level string) (slog.Level, error) {
 	}
 }
 
-func buildOutput(c fiber.Ctx, mappings []FieldMapping) (any, error) {
+func buildOutput(c fiber.Ctx, body *requestBody, mappings []FieldMapping, strategy RootMergeStrategy) (any, error) {
 	output := make(map[string]any, len(mappings))
 	var (
 		rootValue    any
@@ -147,9 +825,18 @@ func buildOutput(c fiber.Ctx, mappings []FieldMapping) (any, error) {
 	)
 
 	for _, m := range mappings {
-		value, err := extractValue(c, m.From)
+		value, err := mappingValue(c, body, m, strategy)
 		if err != nil {
-			return nil, fmt.Errorf("mapping %q -> %q: %w", m.From, m.To, err)
+			switch m.OnError {
+			case OnErrorSkip:
+				continue
+			case OnErrorDefault:
+				// Later steps edit the record in place, so each request
+				// gets its own copy of the configured default.
+				value = cloneJSON(m.Default)
+			default:
+				return nil, fmt.Errorf("mapping %q -> %q: %w", m.From, m.To, err)
+			}
 		}
 		if m.Root {
 			obj, ok := value.(map[string]any)
@@ -157,7 +844,7 @@ func buildOutput(c fiber.Ctx, mappings []FieldMapping) (any, error) {
 				if hasRootValue {
 					return nil, fmt.Errorf("mapping %q cannot merge object root when non-object root already set", m.From)
 				}
-				if err := mergeRootObject(output, obj); err != nil {
+				if err := mergeRootObject(output, obj, strategy); err != nil {
 					return nil, fmt.Errorf("mapping %q as root: %w", m.From, err)
 				}
 				continue
@@ -186,10 +873,48 @@ func buildOutput(c fiber.Ctx, mappings []FieldMapping) (any, error) {
 	return output, nil
 }
 
-func mergeRootObject(dst map[string]any, obj map[string]any) error {
+// mappingValue extracts a mapping's source value, or builds it from its
+// merge sub-mappings, and applies its per-mapping options.
+func mappingValue(c fiber.Ctx, body *requestBody, m FieldMapping, strategy RootMergeStrategy) (any, error) {
+	var (
+		value any
+		err   error
+	)
+	if len(m.Merge) > 0 {
+		value, err = buildOutput(c, body, m.Merge, strategy)
+	} else {
+		value, err = extractValue(c, body, m.From)
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, err = applyParseJSON(value, m)
+	if err != nil {
+		return nil, err
+	}
+	value, err = applyMergeQuery(value, requestQueries(c), m)
+	if err != nil {
+		return nil, err
+	}
+	value = applyKeys(value, m)
+	value = applyInclude(value, m)
+	value, err = applyAffix(value, m.Prefix, m.Suffix, m.OnNonString)
+	if err != nil {
+		return nil, err
+	}
+	return applyPipeline(c, value, m.pipeline)
+}
+
+func mergeRootObject(dst map[string]any, obj map[string]any, strategy RootMergeStrategy) error {
 	for k, v := range obj {
 		if _, exists := dst[k]; exists {
-			return fmt.Errorf("root key collision on %q", k)
+			switch strategy {
+			case RootMergeFirst:
+				continue
+			case RootMergeLast:
+			default:
+				return fmt.Errorf("root key collision on %q", k)
+			}
 		}
 		dst[k] = v
 	}
@@ -197,14 +922,16 @@ func mergeRootObject(dst map[string]any, obj map[string]any) error {
 	return nil
 }
 
-func extractValue(c fiber.Ctx, source Source) (any, error) {
+func extractValue(c fiber.Ctx, body *requestBody, source Source) (any, error) {
 	switch source {
 	case SourceBody:
-		return parseBody(c.Body())
+		return body.Parsed()
 	case SourceHeaders:
-		return c.GetReqHeaders(), nil
+		return requestHeaders(c), nil
 	case SourceQuery:
-		return c.Queries(), nil
+		return requestQueries(c), nil
+	case SourceQueryString:
+		return string(c.Request().URI().QueryString()), nil
 	case SourceParams:
 		return routeParams(c), nil
 	case SourceMethod:
@@ -213,11 +940,82 @@ func extractValue(c fiber.Ctx, source Source) (any, error) {
 		return c.Path(), nil
 	case SourceIP:
 		return c.IP(), nil
+	case SourceRequestID:
+		return requestid.FromContext(c), nil
+	case SourceBodySize:
+		return len(body.Raw()), nil
+	case SourceHTTPVersion:
+		return c.Protocol(), nil
+	case SourceRequestLine:
+		return c.Method() + " " + string(c.Request().RequestURI()) + " " + c.Protocol(), nil
+	case SourceTLSInfo:
+		return tlsInfo(c), nil
+	case SourceJWT:
+		return requestJWTClaims(c)
+	case SourceSeq:
+		return requestSeq(c), nil
+	case SourceTrailers:
+		return requestTrailers(c), nil
+	case SourceAuth:
+		return authInfo(c.Get(fiber.HeaderAuthorization)), nil
 	default:
 		return nil, fmt.Errorf("unsupported source %q", source)
 	}
 }
 
+// requestPretty returns the pretty setting for this request. When
+// allow_request_pretty is enabled, a _pretty query parameter overrides the
+// global setting; it is removed from the query so it never reaches the
+// output.
+func requestPretty(c fiber.Ctx, cfg Config) bool {
+	if !cfg.AllowRequestPretty {
+		return cfg.Pretty
+	}
+
+	args := c.RequestCtx().QueryArgs()
+	if !args.Has(requestPrettyParam) {
+		return cfg.Pretty
+	}
+	value := string(args.Peek(requestPrettyParam))
+	uri := c.Request().URI()
+	uri.SetQueryString(stripQueryParam(string(uri.QueryString()), requestPrettyParam))
+
+	pretty, err := strconv.ParseBool(value)
+	if err != nil {
+		return cfg.Pretty
+	}
+	return pretty
+}
+
+// stripQueryParam removes every occurrence of name from a raw query string
+// while keeping the remaining pairs exactly as they were sent.
+func stripQueryParam(query, name string) string {
+	parts := strings.Split(query, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if key != name {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+func applyEcho(c fiber.Ctx, rules []EchoRule) {
+	for _, rule := range rules {
+		var value string
+		switch rule.From {
+		case SourceHeaders:
+			value = c.Get(rule.Name)
+		case SourceQuery:
+			value = c.Query(rule.Name)
+		}
+		if value != "" {
+			c.Set(rule.Header, value)
+		}
+	}
+}
+
 func routeParams(c fiber.Ctx) map[string]string {
 	params := map[string]string{}
 	route := c.Route()
@@ -232,20 +1030,168 @@ func routeParams(c fiber.Ctx) map[string]string {
 	return params
 }
 
-func parseBody(raw []byte) (any, error) {
+// tlsInfo returns the negotiated TLS version and cipher suite, or nil
+// when the connection is not TLS.
+func tlsInfo(c fiber.Ctx) map[string]any {
+	state := c.RequestCtx().TLSConnectionState()
+	if state == nil {
+		return nil
+	}
+	return map[string]any{
+		"version":      tls.VersionName(state.Version),
+		"cipher_suite": tls.CipherSuiteName(state.CipherSuite),
+	}
+}
+
+// authInfo describes an Authorization header without exposing the
+// credential: the scheme plus a masked token. It returns nil when the
+// header is absent.
+func authInfo(header string) map[string]any {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil
+	}
+
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok {
+		scheme, token = "", header
+	}
+	return map[string]any{
+		"scheme": scheme,
+		"token":  maskToken(strings.TrimSpace(token)),
+	}
+}
+
+// maskToken keeps the first and last 4 characters of long tokens. Tokens
+// of 12 characters or fewer are fully masked, since showing 8 of them
+// would reveal most of the secret.
+func maskToken(token string) string {
+	if len(token) <= 12 {
+		return strings.Repeat("*", len(token))
+	}
+	return token[:4] + "..." + token[len(token)-4:]
+}
+
+// seqCounter numbers requests for the seq source, starting at 1 when the
+// process starts.
+var seqCounter atomic.Uint64
+
+type seqKey struct{}
+
+// requestSeq returns the request's sequence number, taking the next one
+// the first time it is asked for so every seq mapping in a request agrees.
+func requestSeq(c fiber.Ctx) uint64 {
+	if seq, ok := c.Locals(seqKey{}).(uint64); ok {
+		return seq
+	}
+	seq := seqCounter.Add(1)
+	c.Locals(seqKey{}, seq)
+	return seq
+}
+
+// requestTrailers returns the trailers announced in the Trailer header
+// and sent after a chunked body. fasthttp merges trailer values into the
+// request headers, so the announced names are looked up there; names that
+// were announced but never sent are left out.
+func requestTrailers(c fiber.Ctx) map[string]string {
+	trailers := map[string]string{}
+	header := &c.Request().Header
+	for name := range header.Trailers() {
+		if value := header.Peek(string(name)); len(value) > 0 {
+			trailers[string(name)] = string(value)
+		}
+	}
+	return trailers
+}
+
+// checkJSONBody is the require_json_body check: the body must be present
+// and valid JSON.
+func checkJSONBody(raw []byte) error {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return errors.New("request body is required")
+	}
+	if !json.Valid(raw) {
+		return errors.New("request body must be valid JSON")
+	}
+	return nil
+}
+
+// jsonDepthExceeds reports whether raw nests objects and arrays deeper than
+// max, scanning tokens so a deeply nested body is rejected before it is
+// decoded. Scanning stops at the first syntax error, so invalid JSON is
+// only reported if it already nested too deep before that point.
+func jsonDepthExceeds(raw []byte, max int) bool {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > max {
+				return true
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+// parseBody decodes a JSON body, falling back to the body as a string.
+// With captureErrors the fallback is an object holding the string as _raw
+// and the JSON error as _parse_error.
+func parseBody(raw []byte, policy NonUTF8Policy, maxDepth int, captureErrors bool) (any, error) {
 	if len(raw) == 0 {
 		return map[string]any{}, nil
 	}
+	if maxDepth > 0 && jsonDepthExceeds(raw, maxDepth) {
+		return nil, fmt.Errorf("body exceeds max_json_depth of %d", maxDepth)
+	}
 
 	var parsed any
-	if err := json.Unmarshal(raw, &parsed); err != nil {
+	parseErr := json.Unmarshal(raw, &parsed)
+	if parseErr == nil {
+		return parsed, nil
+	}
+	text, err := bodyString(raw, policy)
+	if err != nil || !captureErrors {
+		return text, err
+	}
+	return map[string]any{"_raw": text, "_parse_error": parseErr.Error()}, nil
+}
+
+// bodyString returns a non-JSON body as a string. Bodies that are not
+// valid UTF-8 are handled by policy so they cannot produce invalid JSON
+// output.
+func bodyString(raw []byte, policy NonUTF8Policy) (any, error) {
+	if utf8.Valid(raw) {
 		return string(raw), nil
 	}
 
-	return parsed, nil
+	switch policy {
+	case NonUTF8Base64:
+		return base64.StdEncoding.EncodeToString(raw), nil
+	case NonUTF8Error:
+		return nil, errors.New("body is not valid UTF-8")
+	default:
+		return strings.ToValidUTF8(string(raw), "\uFFFD"), nil
+	}
+}
+
+// printOutput writes payload as one JSON line, preceded by prefix.
+func printOutput(sink outputSink, payload any, pretty bool, prefix string) error {
+	line, err := encodeOutput(payload, pretty, prefix)
+	if err != nil {
+		return err
+	}
+	return sink.Write(line)
 }
 
-func printOutput(payload any, pretty bool) error {
+// encodeOutput encodes payload as one JSON line, preceded by prefix.
+func encodeOutput(payload any, pretty bool, prefix string) ([]byte, error) {
 	var (
 		b   []byte
 		err error
@@ -257,9 +1203,80 @@ func printOutput(payload any, pretty bool) error {
 		b, err = json.Marshal(payload)
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = fmt.Fprintln(os.Stdout, string(b))
-	return err
+	line := make([]byte, 0, len(prefix)+len(b)+1)
+	line = append(line, prefix...)
+	line = append(line, b...)
+	return append(line, '\n'), nil
+}
+
+// bodyHash returns the hex digest of the raw body.
+func bodyHash(raw []byte, algorithm HashAlgorithm) string {
+	var h hash.Hash
+	switch algorithm {
+	case HashSHA1:
+		h = sha1.New()
+	case HashMD5:
+		h = md5.New()
+	default:
+		h = sha256.New()
+	}
+	h.Write(raw)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// injectField sets a top-level field on object output. Non-object output
+// (an array or scalar root) has nowhere to put it and is left unchanged.
+func injectField(output any, key string, value any) {
+	if obj, ok := output.(map[string]any); ok {
+		obj[key] = value
+	}
+}
+
+// isEmptyOutput reports whether mappings produced an empty object, e.g.
+// because every mapping was skipped.
+func isEmptyOutput(output any) bool {
+	obj, ok := output.(map[string]any)
+	return ok && len(obj) == 0
+}
+
+// wrapOutput nests a record under key next to the static meta fields.
+// An empty key leaves the record unchanged.
+func wrapOutput(record any, key string, meta map[string]any) any {
+	if key == "" {
+		return record
+	}
+	wrapped := make(map[string]any, len(meta)+1)
+	for k, v := range meta {
+		wrapped[k] = v
+	}
+	wrapped[key] = record
+	return wrapped
+}
+
+// explodeOutput splits output into one record per element of the array at
+// path, keeping the rest of the output around each element. Outputs where
+// path is unset or does not resolve to a non-empty array yield a single
+// record.
+func explodeOutput(output any, path string) []any {
+	if path == "" {
+		return []any{output}
+	}
+	items, ok := lookupPath(output, path)
+	if !ok {
+		return []any{output}
+	}
+	arr, ok := items.([]any)
+	if !ok || len(arr) == 0 {
+		return []any{output}
+	}
+
+	keys := strings.Split(path, ".")
+	records := make([]any, 0, len(arr))
+	for _, item := range arr {
+		records = append(records, withPath(output, keys, item))
+	}
+	return records
 }
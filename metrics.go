@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type MetricsConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Path    string `json:"path" yaml:"path"`
+}
+
+// metrics holds process-wide counters exposed in the Prometheus text
+// format.
+type metrics struct {
+	inFlight atomic.Int64
+	// responses counts handled webhook requests by status class, indexed
+	// by status / 100.
+	responses [6]atomic.Int64
+}
+
+// countResponse records a finished webhook request under its status class.
+func (m *metrics) countResponse(status int) {
+	if class := status / 100; class >= 1 && class < len(m.responses) {
+		m.responses[class].Add(1)
+	}
+}
+
+// responseCounts returns the request counts by status class, such as
+// "2xx", leaving out classes with no requests.
+func (m *metrics) responseCounts() map[string]int64 {
+	counts := make(map[string]int64)
+	for class := 1; class < len(m.responses); class++ {
+		if n := m.responses[class].Load(); n > 0 {
+			counts[fmt.Sprintf("%dxx", class)] = n
+		}
+	}
+	return counts
+}
+
+func (m *metrics) handler(c fiber.Ctx) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP webhook2stdout_in_flight_requests Webhook requests currently being handled.\n")
+	fmt.Fprintf(&b, "# TYPE webhook2stdout_in_flight_requests gauge\n")
+	fmt.Fprintf(&b, "webhook2stdout_in_flight_requests %d\n", m.inFlight.Load())
+	fmt.Fprintf(&b, "# HELP webhook2stdout_requests_total Webhook requests handled, by status class.\n")
+	fmt.Fprintf(&b, "# TYPE webhook2stdout_requests_total counter\n")
+	for class := 1; class < len(m.responses); class++ {
+		fmt.Fprintf(&b, "webhook2stdout_requests_total{code=\"%dxx\"} %d\n", class, m.responses[class].Load())
+	}
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4")
+	return c.SendString(b.String())
+}
+
+// limitInFlight tracks in-flight webhook requests, counts them by status
+// once handled, and, when limit is positive, rejects requests beyond it
+// with rejection instead of queueing them.
+func limitInFlight(limit int, m *metrics, rejection RejectionResponse, logger *slog.Logger) fiber.Handler {
+	var slots chan struct{}
+	if limit > 0 {
+		slots = make(chan struct{}, limit)
+	}
+
+	return func(c fiber.Ctx) error {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				err := rejection.reject(c, logger, "in flight", nil)
+				m.countResponse(accessLogStatus(c, err))
+				return err
+			}
+		}
+
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+		err := c.Next()
+		m.countResponse(accessLogStatus(c, err))
+		return err
+	}
+}
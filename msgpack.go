@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// OutputFormat is how records are encoded before they reach the sink.
+type OutputFormat string
+
+const (
+	OutputFormatJSON    OutputFormat = "json"
+	OutputFormatMsgpack OutputFormat = "msgpack"
+)
+
+func validateOutputFormat(cfg OutputConfig) error {
+	switch cfg.Format {
+	case OutputFormatJSON:
+		return nil
+	case OutputFormatMsgpack:
+	default:
+		return fmt.Errorf("unsupported output.format %q (use json or msgpack)", cfg.Format)
+	}
+
+	// These sinks read records back as JSON lines or write them into JSON
+	// arrays, which binary frames would corrupt.
+	switch cfg.Mode {
+	case OutputBatchFile, OutputElasticsearch, OutputShardedFile, OutputSessionCapture, OutputPubSub:
+		return fmt.Errorf("output.format %q is not supported in %q mode", OutputFormatMsgpack, cfg.Mode)
+	}
+	return nil
+}
+
+// encodeMsgpack encodes payload as one MessagePack frame: a 4-byte
+// big-endian length followed by the encoded value. MessagePack is binary,
+// so newline framing cannot be used.
+func encodeMsgpack(payload any) ([]byte, error) {
+	frame, err := msgp.AppendIntf(make([]byte, 4, 256), payload)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+	return frame, nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+type OutputMode string
+
+const (
+	OutputStdout         OutputMode = "stdout"
+	OutputBatchFile      OutputMode = "batch_file"
+	OutputExec           OutputMode = "exec"
+	OutputElasticsearch  OutputMode = "elasticsearch"
+	OutputShardedFile    OutputMode = "sharded_file"
+	OutputSessionCapture OutputMode = "session_capture"
+	OutputPubSub         OutputMode = "pubsub"
+)
+
+type OutputConfig struct {
+	Mode            OutputMode        `json:"mode" yaml:"mode"`
+	Format          OutputFormat      `json:"format" yaml:"format"`
+	Gzip            bool              `json:"gzip" yaml:"gzip"`
+	FlushInterval   Duration          `json:"flush_interval" yaml:"flush_interval"`
+	Dir             string            `json:"dir" yaml:"dir"`
+	Window          Duration          `json:"window" yaml:"window"`
+	Command         string            `json:"command" yaml:"command"`
+	Args            []string          `json:"args" yaml:"args"`
+	URL             string            `json:"url" yaml:"url"`
+	Index           string            `json:"index" yaml:"index"`
+	Auth            ElasticsearchAuth `json:"auth" yaml:"auth"`
+	BatchSize       int               `json:"batch_size" yaml:"batch_size"`
+	Path            string            `json:"path" yaml:"path"`
+	MaxOpenFiles    int               `json:"max_open_files" yaml:"max_open_files"`
+	IdleTimeout     Duration          `json:"idle_timeout" yaml:"idle_timeout"`
+	Workers         int               `json:"workers" yaml:"workers"`
+	PartitionKey    string            `json:"partition_key" yaml:"partition_key"`
+	QueueSize       int               `json:"queue_size" yaml:"queue_size"`
+	PausePolicy     PausePolicy       `json:"pause_policy" yaml:"pause_policy"`
+	PauseBuffer     int               `json:"pause_buffer" yaml:"pause_buffer"`
+	MaxRecords      int               `json:"max_records" yaml:"max_records"`
+	Project         string            `json:"project" yaml:"project"`
+	Topic           string            `json:"topic" yaml:"topic"`
+	CredentialsFile string            `json:"credentials_file" yaml:"credentials_file"`
+	Attributes      map[string]string `json:"attributes" yaml:"attributes"`
+}
+
+// outputSink receives encoded output lines.
+type outputSink interface {
+	Write(line []byte) error
+	Close() error
+}
+
+// preflighter is implemented by sinks that can check their destination is
+// usable before the server starts taking traffic.
+type preflighter interface {
+	Preflight() error
+}
+
+// preflightSink runs the sink's preflight check, if it has one.
+func preflightSink(sink outputSink) error {
+	if p, ok := sink.(preflighter); ok {
+		return p.Preflight()
+	}
+	return nil
+}
+
+// checkDirWritable creates dir if needed and proves it is writable by
+// creating and removing a temporary file in it.
+func checkDirWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// lockedWriter serializes writes to w. Handlers write concurrently, and a
+// large line written to a pipe can take several write calls, so without
+// the lock records and log lines sharing a stream could interleave.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) Write(line []byte) error {
+	_, err := s.w.Write(line)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// gzipSink compresses output lines into a single gzip stream. Lines are
+// flushed to the underlying writer every flush interval so that a reader
+// of the stream is never far behind; Close writes the gzip footer.
+type gzipSink struct {
+	mu   sync.Mutex
+	gz   *gzip.Writer
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newGzipSink(w io.Writer, flushInterval time.Duration) *gzipSink {
+	s := &gzipSink{
+		gz:   gzip.NewWriter(w),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.flushLoop(flushInterval)
+	return s
+}
+
+func (s *gzipSink) flushLoop(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			_ = s.gz.Flush()
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *gzipSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.gz.Write(line)
+	return err
+}
+
+func (s *gzipSink) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gz.Close()
+}
+
+func validateOutput(cfg OutputConfig) error {
+	if cfg.Workers < 0 {
+		return fmt.Errorf("output.workers must not be negative")
+	}
+	if cfg.Workers > 0 {
+		if cfg.PartitionKey == "" {
+			return fmt.Errorf("output.partition_key is required when output.workers is set")
+		}
+		if err := validatePath(cfg.PartitionKey); err != nil {
+			return fmt.Errorf("output.partition_key: %w", err)
+		}
+		if cfg.QueueSize <= 0 {
+			return fmt.Errorf("output.queue_size must be positive")
+		}
+	}
+
+	if err := validateOutputFormat(cfg); err != nil {
+		return err
+	}
+	if err := validatePause(cfg); err != nil {
+		return err
+	}
+
+	switch cfg.Mode {
+	case OutputStdout:
+		if cfg.Gzip && cfg.FlushInterval <= 0 {
+			return fmt.Errorf("output.flush_interval must be positive when output.gzip is enabled")
+		}
+	case OutputBatchFile, OutputExec, OutputElasticsearch, OutputShardedFile, OutputSessionCapture, OutputPubSub:
+		if cfg.Gzip {
+			return fmt.Errorf("output.gzip is only supported in %q mode", OutputStdout)
+		}
+	default:
+		return fmt.Errorf("unsupported output.mode %q (use stdout, batch_file, sharded_file, session_capture, exec, elasticsearch, or pubsub)", cfg.Mode)
+	}
+
+	switch cfg.Mode {
+	case OutputBatchFile:
+		if cfg.Dir == "" {
+			return fmt.Errorf("output.dir is required in %q mode", OutputBatchFile)
+		}
+		if cfg.Window <= 0 {
+			return fmt.Errorf("output.window must be positive in %q mode", OutputBatchFile)
+		}
+	case OutputExec:
+		if cfg.Command == "" {
+			return fmt.Errorf("output.command is required in %q mode", OutputExec)
+		}
+	case OutputElasticsearch:
+		return validateElasticsearch(cfg)
+	case OutputPubSub:
+		return validatePubSub(cfg)
+	case OutputShardedFile:
+		if cfg.Path == "" {
+			return fmt.Errorf("output.path is required in %q mode", OutputShardedFile)
+		}
+		if _, err := parseOutputTemplate(cfg.Path); err != nil {
+			return fmt.Errorf("output.path: %w", err)
+		}
+		if cfg.MaxOpenFiles <= 0 {
+			return fmt.Errorf("output.max_open_files must be positive")
+		}
+		if cfg.IdleTimeout <= 0 {
+			return fmt.Errorf("output.idle_timeout must be positive")
+		}
+	case OutputSessionCapture:
+		if cfg.Path == "" {
+			return fmt.Errorf("output.path is required in %q mode", OutputSessionCapture)
+		}
+		if cfg.MaxRecords <= 0 {
+			return fmt.Errorf("output.max_records must be positive")
+		}
+	}
+	return nil
+}
+
+func newOutputSink(cfg OutputConfig, w io.Writer, dead *deadLetter, logger *slog.Logger) (outputSink, error) {
+	sink, err := newModeSink(cfg, w, dead, logger)
+	if err != nil || cfg.Workers == 0 {
+		return sink, err
+	}
+	return newPartitionedSink(sink, cfg, dead, logger), nil
+}
+
+func newModeSink(cfg OutputConfig, w io.Writer, dead *deadLetter, logger *slog.Logger) (outputSink, error) {
+	switch cfg.Mode {
+	case OutputBatchFile:
+		return newBatchFileSink(cfg.Dir, time.Duration(cfg.Window))
+	case OutputExec:
+		return newExecSink(cfg.Command, cfg.Args, logger)
+	case OutputElasticsearch:
+		return newElasticsearchSink(cfg, logger)
+	case OutputShardedFile:
+		return newShardedFileSink(cfg)
+	case OutputSessionCapture:
+		return newSessionCaptureSink(cfg, logger), nil
+	case OutputPubSub:
+		return newPubSubSink(cfg, dead, logger)
+	default:
+		if cfg.Gzip {
+			return newGzipSink(w, time.Duration(cfg.FlushInterval)), nil
+		}
+		return &writerSink{w: w}, nil
+	}
+}
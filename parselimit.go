@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ParseBusyPolicy decides what a request does when every
+// parse_concurrency slot is taken.
+type ParseBusyPolicy string
+
+const (
+	ParseBusyWait   ParseBusyPolicy = "wait"
+	ParseBusyReject ParseBusyPolicy = "reject"
+)
+
+func validateParseLimit(cfg Config) error {
+	if cfg.ParseConcurrency < 0 {
+		return fmt.Errorf("parse_concurrency must not be negative")
+	}
+	switch cfg.ParseBusyPolicy {
+	case ParseBusyWait, ParseBusyReject:
+	default:
+		return fmt.Errorf("unsupported parse_busy_policy %q (use wait or reject)", cfg.ParseBusyPolicy)
+	}
+	return nil
+}
+
+// parseLimiter caps how many requests decode their body at once, so
+// large CPU-bound payloads cannot starve the rest of the process. It is
+// separate from max_in_flight: cheap requests are never held up.
+type parseLimiter struct {
+	slots  chan struct{}
+	policy ParseBusyPolicy
+}
+
+// newParseLimiter returns nil when limit is zero; a nil limiter never
+// blocks.
+func newParseLimiter(limit int, policy ParseBusyPolicy) *parseLimiter {
+	if limit == 0 {
+		return nil
+	}
+	return &parseLimiter{slots: make(chan struct{}, limit), policy: policy}
+}
+
+// acquire takes one slot for every step of the request that scans or
+// decodes the body, so a request holds at most one slot however many of
+// them it runs. It reports false when the policy is reject and no slot is
+// free. release frees the slot and may be called more than once. Requests
+// that never read the body skip the limiter.
+func (l *parseLimiter) acquire(cfg Config, route RouteConfig) (release func(), ok bool) {
+	if l == nil || !parsesBody(cfg, route) {
+		return func() {}, true
+	}
+	if l.policy == ParseBusyReject {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return nil, false
+		}
+	} else {
+		l.slots <- struct{}{}
+	}
+	return sync.OnceFunc(func() { <-l.slots }), true
+}
+
+// parsesBody reports whether a request on route reads its body: to check
+// it is JSON (require_json_body), to check its keys (unknown_keys), or to
+// map or split it (body mappings, batch_path). Passthrough skips all but
+// the JSON check.
+func parsesBody(cfg Config, route RouteConfig) bool {
+	if cfg.RequireJSONBody {
+		return true
+	}
+	if cfg.Passthrough {
+		return false
+	}
+	return cfg.UnknownKeys != UnknownKeysAllow || readsBody(route.Mappings) || route.BatchPath != ""
+}
+
+// readsBody reports whether any mapping, including merge sub-mappings,
+// reads the body source.
+func readsBody(mappings []FieldMapping) bool {
+	return slices.ContainsFunc(mappings, func(m FieldMapping) bool {
+		return m.From == SourceBody || readsBody(m.Merge)
+	})
+}
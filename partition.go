@@ -0,0 +1,125 @@
+package main
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"maps"
+	"sync"
+)
+
+// partitionWriter is implemented by sinks that route each line by a
+// partition key. The key is read from the record before it is encoded, so
+// it works for every output format. letter is the request's dead-letter
+// record, written with the error if the line fails after Write returned;
+// it may be nil.
+type partitionWriter interface {
+	WritePartition(line []byte, key string, letter map[string]any) error
+}
+
+// writeOutputLine writes line to sink, passing key and letter along when
+// the sink partitions its output.
+func writeOutputLine(sink outputSink, line []byte, key string, letter map[string]any) error {
+	if p, ok := sink.(partitionWriter); ok {
+		return p.WritePartition(line, key, letter)
+	}
+	return sink.Write(line)
+}
+
+// partitionKey returns the value at path in record as a string, or "" when
+// record does not have it.
+func partitionKey(record any, path string) string {
+	v, ok := lookupPath(record, path)
+	if !ok {
+		return ""
+	}
+	return templateValue(v)
+}
+
+type partitionedLine struct {
+	line   []byte
+	letter map[string]any
+}
+
+// partitionedSink spreads writes across workers, each with its own ordered
+// queue. Records with the same partition_key value always go to the same
+// worker, so their order is kept while different keys are written in
+// parallel. Writes are asynchronous: errors from the underlying sink are
+// logged and the request is dead-lettered, rather than the error being
+// returned to the request.
+type partitionedSink struct {
+	inner  outputSink
+	dead   *deadLetter
+	logger *slog.Logger
+	queues []chan partitionedLine
+	wg     sync.WaitGroup
+}
+
+func newPartitionedSink(inner outputSink, cfg OutputConfig, dead *deadLetter, logger *slog.Logger) *partitionedSink {
+	s := &partitionedSink{
+		inner:  inner,
+		dead:   dead,
+		logger: logger,
+		queues: make([]chan partitionedLine, cfg.Workers),
+	}
+	for i := range s.queues {
+		s.queues[i] = make(chan partitionedLine, cfg.QueueSize)
+		s.wg.Add(1)
+		go s.work(s.queues[i])
+	}
+	return s
+}
+
+func (s *partitionedSink) work(queue <-chan partitionedLine) {
+	defer s.wg.Done()
+	for item := range queue {
+		err := s.inner.Write(item.line)
+		if err == nil {
+			continue
+		}
+		s.logger.Error("failed to write output", "error", err)
+		if item.letter != nil {
+			// A request's records may be on several workers, so each
+			// failure gets its own copy of the letter.
+			letter := maps.Clone(item.letter)
+			letter["error"] = err.Error()
+			if err := s.dead.writeRecord(letter); err != nil {
+				s.logger.Error("failed to write dead letter", "error", err)
+			}
+		}
+	}
+}
+
+// Write queues line on the first worker. Lines written without a record
+// have no key; writeOutputLine passes the key through WritePartition.
+func (s *partitionedSink) Write(line []byte) error {
+	return s.WritePartition(line, "", nil)
+}
+
+// WritePartition queues line on key's worker, blocking while that queue is
+// full. An empty key, from a record without the key, goes to the first
+// worker.
+func (s *partitionedSink) WritePartition(line []byte, key string, letter map[string]any) error {
+	worker := 0
+	if key != "" {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		worker = int(h.Sum32() % uint32(len(s.queues)))
+	}
+	// The caller may reuse line once Write returns.
+	s.queues[worker] <- partitionedLine{line: append([]byte(nil), line...), letter: letter}
+	return nil
+}
+
+// Preflight checks the underlying sink.
+func (s *partitionedSink) Preflight() error {
+	return preflightSink(s.inner)
+}
+
+// Close drains every queue before closing the underlying sink.
+func (s *partitionedSink) Close() error {
+	for _, q := range s.queues {
+		close(q)
+	}
+	s.wg.Wait()
+	return s.inner.Close()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+func validatePassthrough(cfg Config) error {
+	if !cfg.Passthrough {
+		return nil
+	}
+	switch cfg.Output.Mode {
+	case OutputStdout, OutputExec:
+	default:
+		return fmt.Errorf("passthrough is not supported with output.mode %q (use stdout or exec)", cfg.Output.Mode)
+	}
+	if cfg.Output.Format == OutputFormatMsgpack {
+		return fmt.Errorf("passthrough is not supported with output.format %q", OutputFormatMsgpack)
+	}
+	// There is no record to read the partition key from.
+	if cfg.Output.Workers > 0 {
+		return fmt.Errorf("passthrough is not supported with output.workers")
+	}
+	// There is no record to add the prefix field to.
+	if cfg.OutputPrefix != "" && cfg.OutputPrefixMode == OutputPrefixField {
+		return fmt.Errorf("passthrough is not supported with output_prefix_mode %q (use text)", OutputPrefixField)
+	}
+	if cfg.UnknownKeys != UnknownKeysAllow {
+		return fmt.Errorf("passthrough cannot be combined with unknown_keys %q", cfg.UnknownKeys)
+	}
+	if cfg.AckEchoOutput {
+		return fmt.Errorf("passthrough cannot be combined with ack_echo_output")
+	}
+	// Mappings are ignored, so one that reads the body is a mistake.
+	if readsBody(cfg.Mappings) {
+		return fmt.Errorf("passthrough cannot be combined with body mappings")
+	}
+	for i, r := range cfg.Routes {
+		if readsBody(r.Mappings) {
+			return fmt.Errorf("passthrough cannot be combined with body mappings (routes[%d])", i)
+		}
+	}
+	for _, r := range cfg.routes() {
+		if r.BatchPath != "" {
+			return fmt.Errorf("passthrough cannot be combined with batch_path (route %q)", r.Path)
+		}
+	}
+	if readsBody(cfg.ProviderRoute.Mappings) {
+		return fmt.Errorf("passthrough cannot be combined with body mappings (provider_route)")
+	}
+	for i, p := range cfg.Providers {
+		if readsBody(p.Mappings) {
+			return fmt.Errorf("passthrough cannot be combined with body mappings (providers[%d])", i)
+		}
+	}
+	return nil
+}
+
+// clearDefaultMappings drops the built-in mappings when passthrough is on
+// and the config did not set its own, since the defaults read the body.
+func clearDefaultMappings(cfg *Config) {
+	if cfg.Passthrough && reflect.DeepEqual(cfg.Mappings, defaultConfig().Mappings) {
+		cfg.Mappings = nil
+	}
+}
+
+// passthroughLine returns the raw body as one output line, without
+// parsing it into values. A valid JSON body is compacted onto one line;
+// anything else has backslashes, CR, and LF escaped as \\, \r, and \n so
+// the original bytes can be recovered.
+func passthroughLine(raw []byte, prefix string) []byte {
+	line := bytes.NewBuffer(make([]byte, 0, len(prefix)+len(raw)+1))
+	line.WriteString(prefix)
+	if json.Valid(raw) {
+		_ = json.Compact(line, raw)
+	} else {
+		for _, b := range raw {
+			switch b {
+			case '\\':
+				line.WriteString(`\\`)
+			case '\r':
+				line.WriteString(`\r`)
+			case '\n':
+				line.WriteString(`\n`)
+			default:
+				line.WriteByte(b)
+			}
+		}
+	}
+	line.WriteByte('\n')
+	return line.Bytes()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookupPath resolves a dotted path such as "data.items.0.id" against
+// decoded JSON, descending into objects by key and arrays by index.
+func lookupPath(value any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// updatePath replaces the value at a dotted path with the result of fn.
+// Missing paths are left untouched.
+func updatePath(value any, path string, fn func(any) (any, error)) error {
+	keys := strings.Split(path, ".")
+	parent := value
+	if len(keys) > 1 {
+		var ok bool
+		parent, ok = lookupPath(value, strings.Join(keys[:len(keys)-1], "."))
+		if !ok {
+			return nil
+		}
+	}
+
+	last := keys[len(keys)-1]
+	switch p := parent.(type) {
+	case map[string]any:
+		current, exists := p[last]
+		if !exists {
+			return nil
+		}
+		updated, err := fn(current)
+		if err != nil {
+			return err
+		}
+		p[last] = updated
+	case []any:
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i >= len(p) {
+			return nil
+		}
+		updated, err := fn(p[i])
+		if err != nil {
+			return err
+		}
+		p[i] = updated
+	}
+
+	return nil
+}
+
+func validatePath(path string) error {
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			return fmt.Errorf("invalid path %q", path)
+		}
+	}
+	return nil
+}
+
+// withPath returns a copy of value with the element at path replaced by
+// replacement. Only the containers along the path are copied, so the
+// original value is left untouched.
+func withPath(value any, keys []string, replacement any) any {
+	if len(keys) == 0 {
+		return replacement
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		cp := make(map[string]any, len(v))
+		for k, item := range v {
+			cp[k] = item
+		}
+		cp[keys[0]] = withPath(v[keys[0]], keys[1:], replacement)
+		return cp
+	case []any:
+		i, err := strconv.Atoi(keys[0])
+		if err != nil || i < 0 || i >= len(v) {
+			return value
+		}
+		cp := append([]any(nil), v...)
+		cp[i] = withPath(v[i], keys[1:], replacement)
+		return cp
+	default:
+		return value
+	}
+}
+
+// setPath stores v at a dotted path inside dst, creating intermediate
+// objects as needed.
+func setPath(dst map[string]any, path string, v any) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := dst[key].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			dst[key] = next
+		}
+		dst = next
+	}
+	dst[keys[len(keys)-1]] = v
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// PausePolicy decides what happens to records written while output is
+// paused with SIGUSR1.
+type PausePolicy string
+
+const (
+	PauseBuffer PausePolicy = "buffer"
+	PauseDrop   PausePolicy = "drop"
+)
+
+func validatePause(cfg OutputConfig) error {
+	switch cfg.PausePolicy {
+	case PauseBuffer:
+		if cfg.PauseBuffer <= 0 {
+			return fmt.Errorf("output.pause_buffer must be positive")
+		}
+	case PauseDrop:
+	default:
+		return fmt.Errorf("unsupported output.pause_policy %q (use buffer or drop)", cfg.PausePolicy)
+	}
+	return nil
+}
+
+// pausableSink lets output be paused for downstream maintenance. While
+// paused, writes succeed so requests are still acked, and records are
+// held in memory up to a cap or dropped, per policy. Resuming writes held
+// records out in order before new ones.
+type pausableSink struct {
+	mu      sync.Mutex
+	inner   outputSink
+	policy  PausePolicy
+	limit   int
+	logger  *slog.Logger
+	paused  bool
+	held    []heldLine
+	dropped int
+}
+
+// heldLine is a line written while paused, with the partition key and
+// dead-letter record it was written with.
+type heldLine struct {
+	line   []byte
+	key    string
+	letter map[string]any
+}
+
+func newPausableSink(inner outputSink, cfg OutputConfig, logger *slog.Logger) *pausableSink {
+	return &pausableSink{inner: inner, policy: cfg.PausePolicy, limit: cfg.PauseBuffer, logger: logger}
+}
+
+func (s *pausableSink) Write(line []byte) error {
+	return s.WritePartition(line, "", nil)
+}
+
+// WritePartition passes key and letter on to a partitioned inner sink,
+// holding them with the line while paused.
+func (s *pausableSink) WritePartition(line []byte, key string, letter map[string]any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.paused {
+		return writeOutputLine(s.inner, line, key, letter)
+	}
+	if s.policy == PauseDrop || len(s.held) >= s.limit {
+		if s.dropped == 0 && s.policy == PauseBuffer {
+			s.logger.Warn("pause buffer full, dropping records", "pause_buffer", s.limit)
+		}
+		s.dropped++
+		return nil
+	}
+	// The caller may reuse line after Write returns.
+	s.held = append(s.held, heldLine{line: append([]byte(nil), line...), key: key, letter: letter})
+	return nil
+}
+
+func (s *pausableSink) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.paused {
+		s.paused = true
+		s.logger.Info("output paused", "pause_policy", s.policy)
+	}
+}
+
+func (s *pausableSink) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused {
+		s.paused = false
+		s.logger.Info("output resumed", "held", len(s.held), "dropped", s.dropped)
+		s.flushHeld()
+	}
+}
+
+// flushHeld writes held records to the inner sink. Callers hold s.mu.
+func (s *pausableSink) flushHeld() {
+	for _, h := range s.held {
+		if err := writeOutputLine(s.inner, h.line, h.key, h.letter); err != nil {
+			s.logger.Error("failed to write output", "error", err)
+		}
+	}
+	s.held = nil
+	s.dropped = 0
+}
+
+// handlePauseSignals pauses output on SIGUSR1 and resumes it on SIGUSR2
+// until ctx is done.
+func handlePauseSignals(ctx context.Context, s *pausableSink) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case sig := <-sigs:
+				if sig == syscall.SIGUSR1 {
+					s.Pause()
+				} else {
+					s.Resume()
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (s *pausableSink) Preflight() error {
+	return preflightSink(s.inner)
+}
+
+// Close writes out anything still held, so stopping while paused does not
+// lose buffered records.
+func (s *pausableSink) Close() error {
+	s.mu.Lock()
+	s.flushHeld()
+	s.mu.Unlock()
+	return s.inner.Close()
+}
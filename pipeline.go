@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const redactedValue = "[REDACTED]"
+
+// TransformStep is one entry of a mapping's transforms list: a single key
+// naming the transform, whose value holds its arguments.
+type TransformStep map[string]any
+
+// transform rewrites a mapping's value as one step of its pipeline.
+type transform interface {
+	apply(c fiber.Ctx, value any) (any, error)
+}
+
+type transformFunc func(c fiber.Ctx, value any) (any, error)
+
+func (f transformFunc) apply(c fiber.Ctx, value any) (any, error) { return f(c, value) }
+
+// transformBuilders maps transform names to constructors. Each decodes its
+// arguments and closes over the mapping for settings it shares with the
+// matching single-purpose option, such as parse_json_strict.
+var transformBuilders = map[string]func(args any, m FieldMapping) (transform, error){
+	"parse_json": func(args any, m FieldMapping) (transform, error) {
+		var paths []string
+		if err := decodeTransformArgs(args, &paths); err != nil {
+			return nil, err
+		}
+		if err := validatePaths(paths); err != nil {
+			return nil, err
+		}
+		step := FieldMapping{ParseJSON: paths, ParseJSONStrict: m.ParseJSONStrict}
+		return transformFunc(func(_ fiber.Ctx, value any) (any, error) {
+			return applyParseJSON(value, step)
+		}), nil
+	},
+	"include": func(args any, m FieldMapping) (transform, error) {
+		var paths []string
+		if err := decodeTransformArgs(args, &paths); err != nil {
+			return nil, err
+		}
+		if err := validatePaths(paths); err != nil {
+			return nil, err
+		}
+		step := FieldMapping{Include: paths, IncludeDefaults: m.IncludeDefaults}
+		return transformFunc(func(_ fiber.Ctx, value any) (any, error) {
+			return applyInclude(value, step), nil
+		}), nil
+	},
+	"keys": func(args any, _ FieldMapping) (transform, error) {
+		var keys []string
+		if err := decodeTransformArgs(args, &keys); err != nil {
+			return nil, err
+		}
+		step := FieldMapping{Keys: keys}
+		return transformFunc(func(_ fiber.Ctx, value any) (any, error) {
+			return applyKeys(value, step), nil
+		}), nil
+	},
+	"merge_query": func(args any, _ FieldMapping) (transform, error) {
+		var policy MergeQueryPolicy
+		if err := decodeTransformArgs(args, &policy); err != nil {
+			return nil, err
+		}
+		if policy != MergeQueryPreferBody && policy != MergeQueryPreferQuery {
+			return nil, fmt.Errorf("unsupported policy %q (use prefer_body or prefer_query)", policy)
+		}
+		step := FieldMapping{MergeQuery: policy}
+		return transformFunc(func(c fiber.Ctx, value any) (any, error) {
+			return applyMergeQuery(value, requestQueries(c), step)
+		}), nil
+	},
+	"rename": func(args any, m FieldMapping) (transform, error) {
+		var renames map[string]string
+		if err := decodeTransformArgs(args, &renames); err != nil {
+			return nil, err
+		}
+		return transformFunc(func(_ fiber.Ctx, value any) (any, error) {
+			return applyRename(value, renames, m.keyCollision)
+		}), nil
+	},
+	"coerce_scalars": func(args any, _ FieldMapping) (transform, error) {
+		var opts struct {
+			Paths []string `json:"paths"`
+			Types []string `json:"types"`
+		}
+		if err := decodeTransformArgs(args, &opts); err != nil {
+			return nil, err
+		}
+		if err := validatePaths(opts.Paths); err != nil {
+			return nil, err
+		}
+		types, err := parseCoerceTypes(opts.Types)
+		if err != nil {
+			return nil, err
+		}
+		return transformFunc(func(_ fiber.Ctx, value any) (any, error) {
+			return applyCoerceScalars(value, opts.Paths, types)
+		}), nil
+	},
+	"prefix": func(args any, m FieldMapping) (transform, error) {
+		var prefix string
+		if err := decodeTransformArgs(args, &prefix); err != nil {
+			return nil, err
+		}
+		return transformFunc(func(_ fiber.Ctx, value any) (any, error) {
+			return applyAffix(value, prefix, "", m.OnNonString)
+		}), nil
+	},
+	"suffix": func(args any, m FieldMapping) (transform, error) {
+		var suffix string
+		if err := decodeTransformArgs(args, &suffix); err != nil {
+			return nil, err
+		}
+		return transformFunc(func(_ fiber.Ctx, value any) (any, error) {
+			return applyAffix(value, "", suffix, m.OnNonString)
+		}), nil
+	},
+	"redact": func(args any, _ FieldMapping) (transform, error) {
+		var paths []string
+		if err := decodeTransformArgs(args, &paths); err != nil {
+			return nil, err
+		}
+		if err := validatePaths(paths); err != nil {
+			return nil, err
+		}
+		return transformFunc(func(_ fiber.Ctx, value any) (any, error) {
+			return applyRedact(value, paths)
+		}), nil
+	},
+}
+
+// newPipeline builds the transforms of a mapping in order.
+func newPipeline(m FieldMapping) ([]transform, error) {
+	pipeline := make([]transform, 0, len(m.Transforms))
+	for i, step := range m.Transforms {
+		if len(step) != 1 {
+			return nil, fmt.Errorf("transforms[%d] must name exactly one transform", i)
+		}
+		for name, args := range step {
+			build, ok := transformBuilders[name]
+			if !ok {
+				return nil, fmt.Errorf("transforms[%d]: unknown transform %q (use %s)", i, name, transformNames())
+			}
+			t, err := build(args, m)
+			if err != nil {
+				return nil, fmt.Errorf("transforms[%d].%s: %w", i, name, err)
+			}
+			pipeline = append(pipeline, t)
+		}
+	}
+	return pipeline, nil
+}
+
+// compileMappings returns copies of mappings with their transform
+// pipelines built, so requests do not decode transform arguments.
+func compileMappings(mappings []FieldMapping, keyCollision KeyCollisionPolicy) ([]FieldMapping, error) {
+	compiled := make([]FieldMapping, len(mappings))
+	for i, m := range mappings {
+		m.keyCollision = keyCollision
+		pipeline, err := newPipeline(m)
+		if err != nil {
+			return nil, fmt.Errorf("mappings[%d].%w", i, err)
+		}
+		m.pipeline = pipeline
+		if len(m.Merge) > 0 {
+			if m.Merge, err = compileMappings(m.Merge, keyCollision); err != nil {
+				return nil, fmt.Errorf("mappings[%d].merge: %w", i, err)
+			}
+		}
+		compiled[i] = m
+	}
+	return compiled, nil
+}
+
+func applyPipeline(c fiber.Ctx, value any, pipeline []transform) (any, error) {
+	for _, t := range pipeline {
+		var err error
+		if value, err = t.apply(c, value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// decodeTransformArgs converts decoded YAML or JSON arguments into dst by
+// round-tripping them through JSON.
+func decodeTransformArgs(args any, dst any) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func validatePaths(paths []string) error {
+	for _, path := range paths {
+		if err := validatePath(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func transformNames() string {
+	names := make([]string, 0, len(transformBuilders))
+	for name := range transformBuilders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ProtobufConfig enables decoding protobuf request bodies. DescriptorSet
+// is a serialized FileDescriptorSet, as produced by
+// `protoc --include_imports --descriptor_set_out`, and Message is the
+// fully-qualified name of the body's message type.
+type ProtobufConfig struct {
+	DescriptorSet string `json:"descriptor_set" yaml:"descriptor_set"`
+	Message       string `json:"message" yaml:"message"`
+}
+
+func (p ProtobufConfig) enabled() bool {
+	return p.DescriptorSet != ""
+}
+
+// bodyDecoder turns a raw request body into the value used by body
+// mappings.
+type bodyDecoder func(raw []byte) (any, error)
+
+func newBodyDecoder(cfg Config) (bodyDecoder, error) {
+	if !cfg.Protobuf.enabled() {
+		return func(raw []byte) (any, error) {
+			return parseBody(raw, cfg.NonUTF8Policy, cfg.MaxJSONDepth, cfg.CaptureParseErrors)
+		}, nil
+	}
+
+	md, err := loadProtoMessage(cfg.Protobuf)
+	if err != nil {
+		return nil, err
+	}
+	return func(raw []byte) (any, error) {
+		decoded, err := decodeProtobuf(md, raw)
+		if err != nil {
+			return base64.StdEncoding.EncodeToString(raw), nil
+		}
+		return decoded, nil
+	}, nil
+}
+
+func loadProtoMessage(cfg ProtobufConfig) (protoreflect.MessageDescriptor, error) {
+	data, err := os.ReadFile(cfg.DescriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("read protobuf descriptor set: %w", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("unmarshal protobuf descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("build protobuf descriptors: %w", err)
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(cfg.Message))
+	if err != nil {
+		return nil, fmt.Errorf("protobuf message %q: %w", cfg.Message, err)
+	}
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("protobuf %q is not a message", cfg.Message)
+	}
+	return md, nil
+}
+
+// decodeProtobuf decodes raw into a message of type md and converts it to
+// the same shape JSON bodies have, using the canonical protobuf JSON
+// mapping.
+func decodeProtobuf(md protoreflect.MessageDescriptor, raw []byte) (any, error) {
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(raw, msg); err != nil {
+		return nil, err
+	}
+
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
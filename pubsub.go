@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	pubsubEndpoint = "https://pubsub.googleapis.com"
+	pubsubScope    = "https://www.googleapis.com/auth/pubsub"
+	pubsubTimeout  = 30 * time.Second
+	// pubsubMaxBatch is the most messages one publish request may carry.
+	pubsubMaxBatch = 1000
+	// pubsubMaxBatchBytes keeps publish requests safely under the 10MB
+	// request size limit, leaving room for the JSON around the messages.
+	pubsubMaxBatchBytes = 9 << 20
+	// pubsubMessageOverhead approximates the JSON framing of one message.
+	pubsubMessageOverhead = 64
+)
+
+// pubsubMessage is one message of a publish request.
+type pubsubMessage struct {
+	Data       string            `json:"data"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// pubsubSink publishes records to a Google Cloud Pub/Sub topic through
+// the REST API. Records are buffered and published when batch_size is
+// reached, when the batch would grow past pubsubMaxBatchBytes, or every
+// flush interval; whatever is buffered is published on Close. Batches
+// that fail to publish are logged and, with dead_letter set, written there
+// so they are not lost silently.
+type pubsubSink struct {
+	mu           sync.Mutex
+	sendMu       sync.Mutex
+	url          string
+	topic        string
+	attributes   map[string]string
+	limit        int
+	client       *http.Client
+	dead         *deadLetter
+	logger       *slog.Logger
+	pending      []pubsubMessage
+	pendingBytes int
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+func newPubSubSink(cfg OutputConfig, dead *deadLetter, logger *slog.Logger) (*pubsubSink, error) {
+	endpoint := pubsubEndpoint
+	client := &http.Client{Timeout: pubsubTimeout}
+	// The emulator speaks plain HTTP and needs no credentials.
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		endpoint = "http://" + host
+	} else {
+		creds, err := pubsubCredentials(cfg.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("pubsub credentials: %w", err)
+		}
+		client = oauth2.NewClient(context.Background(), creds.TokenSource)
+		client.Timeout = pubsubTimeout
+	}
+
+	topic := "projects/" + cfg.Project + "/topics/" + cfg.Topic
+	s := &pubsubSink{
+		url:        endpoint + "/v1/" + topic,
+		topic:      topic,
+		attributes: cfg.Attributes,
+		limit:      cfg.BatchSize,
+		client:     client,
+		dead:       dead,
+		logger:     logger,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go s.flushLoop(time.Duration(cfg.FlushInterval))
+	return s, nil
+}
+
+// pubsubCredentials loads a service account or other credentials JSON
+// file, or Application Default Credentials when file is empty.
+func pubsubCredentials(file string) (*google.Credentials, error) {
+	ctx := context.Background()
+	if file == "" {
+		return google.FindDefaultCredentials(ctx, pubsubScope)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return google.CredentialsFromJSON(ctx, data, pubsubScope)
+}
+
+func (s *pubsubSink) flushLoop(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *pubsubSink) Write(line []byte) error {
+	var data bytes.Buffer
+	// Pretty-printed lines are compacted so each message is one JSON value.
+	if err := json.Compact(&data, line); err != nil {
+		return fmt.Errorf("pubsub output: %w", err)
+	}
+	msg := pubsubMessage{Data: base64.StdEncoding.EncodeToString(data.Bytes())}
+	if len(s.attributes) > 0 {
+		var record any
+		if err := json.Unmarshal(data.Bytes(), &record); err != nil {
+			return fmt.Errorf("pubsub output: %w", err)
+		}
+		msg.Attributes = pubsubAttributes(record, s.attributes)
+	}
+
+	size := msg.size()
+	for {
+		s.mu.Lock()
+		// A message that would push the batch over the size cap goes into
+		// the next one; a single oversized message is still sent alone.
+		if len(s.pending) > 0 && s.pendingBytes+size > pubsubMaxBatchBytes {
+			s.mu.Unlock()
+			s.flush()
+			continue
+		}
+		s.pending = append(s.pending, msg)
+		s.pendingBytes += size
+		full := len(s.pending) >= s.limit || s.pendingBytes >= pubsubMaxBatchBytes
+		s.mu.Unlock()
+
+		if full {
+			s.flush()
+		}
+		return nil
+	}
+}
+
+// size approximates the message's share of a publish request body.
+func (m pubsubMessage) size() int {
+	n := len(m.Data) + pubsubMessageOverhead
+	for k, v := range m.Attributes {
+		n += len(k) + len(v) + 8
+	}
+	return n
+}
+
+// pubsubAttributes reads each attribute from its dotted path in record.
+// Strings are used as is and other values as JSON; missing paths are
+// left out.
+func pubsubAttributes(record any, paths map[string]string) map[string]string {
+	attrs := make(map[string]string, len(paths))
+	for name, path := range paths {
+		v, ok := lookupPath(record, path)
+		if !ok || v == nil {
+			continue
+		}
+		if s, ok := v.(string); ok {
+			attrs[name] = s
+			continue
+		}
+		if b, err := json.Marshal(v); err == nil {
+			attrs[name] = string(b)
+		}
+	}
+	return attrs
+}
+
+// flush publishes the buffered records. Publishes are serialized so
+// batches reach the topic in order.
+func (s *pubsubSink) flush() {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	s.pending, s.pendingBytes = nil, 0
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := s.publish(batch); err != nil {
+		s.logger.Error("pubsub publish failed", "topic", s.topic, "records", len(batch), "error", err)
+		s.deadLetter(batch, err)
+	}
+}
+
+func (s *pubsubSink) publish(batch []pubsubMessage) error {
+	body, err := json.Marshal(map[string]any{"messages": batch})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url+":publish", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	return nil
+}
+
+// deadLetter writes each message of a failed batch to the dead-letter
+// file, with its record decoded back from the message data.
+func (s *pubsubSink) deadLetter(batch []pubsubMessage, publishErr error) {
+	if s.dead == nil {
+		return
+	}
+	for _, msg := range batch {
+		data, _ := base64.StdEncoding.DecodeString(msg.Data)
+		letter := map[string]any{
+			"failed_at":  time.Now().UTC().Format(time.RFC3339Nano),
+			"reason":     "pubsub publish",
+			"error":      publishErr.Error(),
+			"topic":      s.topic,
+			"record":     json.RawMessage(data),
+			"attributes": msg.Attributes,
+		}
+		if err := s.dead.writeRecord(letter); err != nil {
+			s.logger.Error("failed to write dead letter", "error", err)
+			return
+		}
+	}
+}
+
+// Preflight checks that the topic exists and the credentials can see it.
+func (s *pubsubSink) Preflight() error {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return fmt.Errorf("pubsub: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("pubsub: unexpected status %d for %s", resp.StatusCode, s.topic)
+	}
+	return nil
+}
+
+func (s *pubsubSink) Close() error {
+	close(s.stop)
+	<-s.done
+	s.flush()
+	return nil
+}
+
+func validatePubSub(cfg OutputConfig) error {
+	if cfg.Project == "" {
+		return fmt.Errorf("output.project is required in %q mode", OutputPubSub)
+	}
+	if cfg.Topic == "" {
+		return fmt.Errorf("output.topic is required in %q mode", OutputPubSub)
+	}
+	if cfg.BatchSize <= 0 || cfg.BatchSize > pubsubMaxBatch {
+		return fmt.Errorf("output.batch_size must be between 1 and %d in %q mode", pubsubMaxBatch, OutputPubSub)
+	}
+	if cfg.FlushInterval <= 0 {
+		return fmt.Errorf("output.flush_interval must be positive in %q mode", OutputPubSub)
+	}
+	for name, path := range cfg.Attributes {
+		if name == "" || strings.HasPrefix(name, "goog") {
+			return fmt.Errorf("output.attributes name %q must be non-empty and not start with \"goog\"", name)
+		}
+		if err := validatePath(path); err != nil {
+			return fmt.Errorf("output.attributes.%s: %w", name, err)
+		}
+	}
+	return nil
+}
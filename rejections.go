@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+)
+
+// RejectionResponse is the status and JSON body sent when a request is
+// rejected. A null body sends the status with no body.
+type RejectionResponse struct {
+	Status int `json:"status" yaml:"status"`
+	Body   any `json:"body" yaml:"body"`
+}
+
+type RejectionsConfig struct {
+	Auth      RejectionResponse `json:"auth" yaml:"auth"`
+	Signature RejectionResponse `json:"signature" yaml:"signature"`
+	InFlight  RejectionResponse `json:"in_flight" yaml:"in_flight"`
+	BodySize  RejectionResponse `json:"body_size" yaml:"body_size"`
+	Draining  RejectionResponse `json:"draining" yaml:"draining"`
+	ParseBusy RejectionResponse `json:"parse_busy" yaml:"parse_busy"`
+}
+
+func defaultRejectionsConfig() RejectionsConfig {
+	return RejectionsConfig{
+		Auth:      RejectionResponse{Status: fiber.StatusUnauthorized, Body: map[string]any{"error": "unauthorized"}},
+		Signature: RejectionResponse{Status: fiber.StatusUnauthorized, Body: map[string]any{"error": "invalid signature"}},
+		InFlight:  RejectionResponse{Status: fiber.StatusServiceUnavailable, Body: map[string]any{"error": "too many requests in flight"}},
+		BodySize:  RejectionResponse{Status: fiber.StatusRequestEntityTooLarge, Body: map[string]any{"error": "request body too large"}},
+		Draining:  RejectionResponse{Status: fiber.StatusServiceUnavailable, Body: map[string]any{"error": "shutting down"}},
+		ParseBusy: RejectionResponse{Status: fiber.StatusServiceUnavailable, Body: map[string]any{"error": "server busy"}},
+	}
+}
+
+func validateRejections(cfg RejectionsConfig) error {
+	for name, r := range map[string]RejectionResponse{
+		"auth":       cfg.Auth,
+		"signature":  cfg.Signature,
+		"in_flight":  cfg.InFlight,
+		"body_size":  cfg.BodySize,
+		"draining":   cfg.Draining,
+		"parse_busy": cfg.ParseBusy,
+	} {
+		if r.Status < 100 || r.Status > 599 {
+			return fmt.Errorf("rejections.%s.status must be a valid HTTP status code", name)
+		}
+	}
+	return nil
+}
+
+// logRejection writes the log entry shared by every rejection, so
+// rejections can be counted and alerted on by reason.
+func logRejection(logger *slog.Logger, c fiber.Ctx, reason string, status int, err error) {
+	attrs := []any{
+		"reason", reason,
+		"status", status,
+		"ip", c.IP(),
+		"method", c.Method(),
+		"path", c.Path(),
+		"request_id", requestid.FromContext(c),
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	logger.Warn("rejected request", attrs...)
+}
+
+// reject logs the rejection and sends the configured response.
+func (r RejectionResponse) reject(c fiber.Ctx, logger *slog.Logger, reason string, err error) error {
+	logRejection(logger, c, reason, r.Status, err)
+	return r.send(c)
+}
+
+func (r RejectionResponse) send(c fiber.Ctx) error {
+	if r.Body == nil {
+		return c.Status(r.Status).Send(nil)
+	}
+	return c.Status(r.Status).JSON(r.Body)
+}
+
+// rejectionErrorHandler answers requests that fasthttp rejects before any
+// handler runs, such as bodies over server.body_limit, and leaves other
+// errors to fiber's default handler.
+func rejectionErrorHandler(cfg RejectionsConfig, logger *slog.Logger) fiber.ErrorHandler {
+	return func(c fiber.Ctx, err error) error {
+		if errors.Is(err, fiber.ErrRequestEntityTooLarge) {
+			return cfg.BodySize.reject(c, logger, "body size", err)
+		}
+		return fiber.DefaultErrorHandler(c, err)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RouteConfig is one webhook endpoint. Mappings, LogLevel, and the
+// signature settings fall back to the top-level values when omitted.
+type RouteConfig struct {
+	Path         string              `json:"path" yaml:"path"`
+	Enabled      *bool               `json:"enabled" yaml:"enabled"`
+	LogLevel     string              `json:"log_level" yaml:"log_level"`
+	SlackVerify  *SlackVerifyConfig  `json:"slack_verify" yaml:"slack_verify"`
+	GitHubVerify *GitHubVerifyConfig `json:"github_verify" yaml:"github_verify"`
+	Mappings     []FieldMapping      `json:"mappings" yaml:"mappings"`
+	// AckFirst sends the ack before writing output; see ack_first.
+	AckFirst *bool `json:"ack_first" yaml:"ack_first"`
+	// BatchPath is the dotted body path to an array of events that are
+	// mapped one by one; see batch_path.
+	BatchPath string `json:"batch_path" yaml:"batch_path"`
+}
+
+// enabled reports whether the route is served. Routes are enabled unless
+// they set enabled: false.
+func (r RouteConfig) enabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+func (r RouteConfig) ackFirst() bool {
+	return r.AckFirst != nil && *r.AckFirst
+}
+
+// ProviderConfig generates one route from provider_route. Settings it
+// sets override the template's.
+type ProviderConfig struct {
+	Name        string `json:"name" yaml:"name"`
+	RouteConfig `yaml:",inline"`
+}
+
+// providerPlaceholder is replaced by the provider name in route paths.
+const providerPlaceholder = "{name}"
+
+var providerNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// providerRoutes expands providers into routes based on provider_route.
+func (cfg Config) providerRoutes() []RouteConfig {
+	routes := make([]RouteConfig, 0, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		r := cfg.ProviderRoute
+		if p.Path != "" {
+			r.Path = p.Path
+		}
+		r.Path = strings.ReplaceAll(r.Path, providerPlaceholder, p.Name)
+		if p.Enabled != nil {
+			r.Enabled = p.Enabled
+		}
+		if p.LogLevel != "" {
+			r.LogLevel = p.LogLevel
+		}
+		if p.SlackVerify != nil {
+			r.SlackVerify = p.SlackVerify
+		}
+		if p.GitHubVerify != nil {
+			r.GitHubVerify = p.GitHubVerify
+		}
+		if len(p.Mappings) > 0 {
+			r.Mappings = p.Mappings
+		}
+		if p.AckFirst != nil {
+			r.AckFirst = p.AckFirst
+		}
+		if p.BatchPath != "" {
+			r.BatchPath = p.BatchPath
+		}
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+// routes returns the effective webhook routes: the routes list followed
+// by the provider routes. Without either, the top-level route and
+// mappings form a single route. Disabled routes are left out.
+func (cfg Config) routes() []RouteConfig {
+	if len(cfg.Routes) == 0 && len(cfg.Providers) == 0 {
+		return []RouteConfig{cfg.routeDefaults(RouteConfig{Path: cfg.Route})}
+	}
+
+	routes := make([]RouteConfig, 0, len(cfg.Routes)+len(cfg.Providers))
+	for _, r := range append(slices.Clone(cfg.Routes), cfg.providerRoutes()...) {
+		if !r.enabled() {
+			continue
+		}
+		routes = append(routes, cfg.routeDefaults(r))
+	}
+	return routes
+}
+
+// routeDefaults fills the settings r leaves unset from the top level. The
+// signature settings are copied so routes never share them. A route
+// slack_verify without a tolerance uses the top-level tolerance.
+func (cfg Config) routeDefaults(r RouteConfig) RouteConfig {
+	if r.LogLevel == "" {
+		r.LogLevel = cfg.LogLevel
+	}
+	if len(r.Mappings) == 0 {
+		r.Mappings = cfg.Mappings
+	}
+	if r.AckFirst == nil {
+		r.AckFirst = &cfg.AckFirst
+	}
+	if r.BatchPath == "" {
+		r.BatchPath = cfg.BatchPath
+	}
+
+	slack := cfg.SlackVerify
+	if r.SlackVerify != nil {
+		slack.SigningSecret = r.SlackVerify.SigningSecret
+		if r.SlackVerify.Tolerance != 0 {
+			slack.Tolerance = r.SlackVerify.Tolerance
+		}
+	}
+	r.SlackVerify = &slack
+
+	github := cfg.GitHubVerify
+	if r.GitHubVerify != nil {
+		github = *r.GitHubVerify
+	}
+	r.GitHubVerify = &github
+	return r
+}
+
+func validateRoutes(cfg Config) error {
+	names := map[string]struct{}{}
+	for i, p := range cfg.Providers {
+		if !providerNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("providers[%d].name must be non-empty and use only letters, digits, '.', '_', or '-'", i)
+		}
+		if _, ok := names[p.Name]; ok {
+			return fmt.Errorf("duplicate provider name %q", p.Name)
+		}
+		names[p.Name] = struct{}{}
+	}
+
+	labels := make([]string, 0, len(cfg.Routes)+len(cfg.Providers))
+	for i := range cfg.Routes {
+		labels = append(labels, fmt.Sprintf("routes[%d]", i))
+	}
+	for i := range cfg.Providers {
+		labels = append(labels, fmt.Sprintf("providers[%d]", i))
+	}
+
+	seen := map[string]string{}
+	for i, r := range append(slices.Clone(cfg.Routes), cfg.providerRoutes()...) {
+		label := labels[i]
+		if !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("%s.path must start with '/'", label)
+		}
+		if prev, ok := seen[r.Path]; ok {
+			return fmt.Errorf("duplicate route path %q (%s and %s)", r.Path, prev, label)
+		}
+		seen[r.Path] = label
+		if _, err := parseLogLevel(r.LogLevel); err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+		if slack := cfg.routeDefaults(r).SlackVerify; slack.SigningSecret != "" && slack.Tolerance <= 0 {
+			return fmt.Errorf("%s.slack_verify.tolerance must be positive", label)
+		}
+		if err := validateMappings(label+".mappings", r.Mappings, cfg.KeyCase); err != nil {
+			return err
+		}
+		if r.BatchPath != "" {
+			if err := validatePath(r.BatchPath); err != nil {
+				return fmt.Errorf("%s.batch_path: %w", label, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveRouteSecrets expands env: and file: references in a route's
+// signature secrets.
+func resolveRouteSecrets(r *RouteConfig, label string) error {
+	var err error
+	if r.SlackVerify != nil {
+		if r.SlackVerify.SigningSecret, err = resolveSecret(r.SlackVerify.SigningSecret); err != nil {
+			return fmt.Errorf("%s.slack_verify.signing_secret: %w", label, err)
+		}
+	}
+	if r.GitHubVerify != nil {
+		if r.GitHubVerify.Secret, err = resolveSecret(r.GitHubVerify.Secret); err != nil {
+			return fmt.Errorf("%s.github_verify.secret: %w", label, err)
+		}
+	}
+	return nil
+}
+
+// maskRouteSecrets replaces a route's signature secrets with copies that
+// hold the mask, leaving the originals untouched.
+func maskRouteSecrets(r *RouteConfig) {
+	if r.SlackVerify != nil {
+		slack := *r.SlackVerify
+		if slack.SigningSecret != "" {
+			slack.SigningSecret = maskedSecret
+		}
+		r.SlackVerify = &slack
+	}
+	if r.GitHubVerify != nil {
+		github := *r.GitHubVerify
+		if github.Secret != "" {
+			github.Secret = maskedSecret
+		}
+		r.GitHubVerify = &github
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type ServerConfig struct {
+	Concurrency     int  `json:"concurrency" yaml:"concurrency"`
+	ReadBufferSize  int  `json:"read_buffer_size" yaml:"read_buffer_size"`
+	WriteBufferSize int  `json:"write_buffer_size" yaml:"write_buffer_size"`
+	BodyLimit       int  `json:"body_limit" yaml:"body_limit"`
+	StrictRouting   bool `json:"strict_routing" yaml:"strict_routing"`
+	CaseSensitive   bool `json:"case_sensitive" yaml:"case_sensitive"`
+	// ServerHeader is sent as the Server response header; empty omits it.
+	ServerHeader string `json:"server_header" yaml:"server_header"`
+	AppName      string `json:"app_name" yaml:"app_name"`
+	// RequireContentLength rejects bodies sent without a Content-Length,
+	// such as chunked ones, for deployments that want to refuse them.
+	RequireContentLength bool `json:"require_content_length" yaml:"require_content_length"`
+	// DrainDelay keeps the listener open after a shutdown signal while
+	// new webhook requests are rejected, so load balancers can notice.
+	DrainDelay Duration `json:"drain_delay" yaml:"drain_delay"`
+}
+
+func defaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Concurrency:     fiber.DefaultConcurrency,
+		ReadBufferSize:  fiber.DefaultReadBufferSize,
+		WriteBufferSize: fiber.DefaultWriteBufferSize,
+		BodyLimit:       fiber.DefaultBodyLimit,
+		ServerHeader:    "wh-logger",
+		AppName:         "Webhook Logger",
+	}
+}
+
+func validateServer(cfg ServerConfig) error {
+	if cfg.Concurrency <= 0 {
+		return fmt.Errorf("server.concurrency must be positive")
+	}
+	if cfg.ReadBufferSize <= 0 {
+		return fmt.Errorf("server.read_buffer_size must be positive")
+	}
+	if cfg.WriteBufferSize <= 0 {
+		return fmt.Errorf("server.write_buffer_size must be positive")
+	}
+	if cfg.BodyLimit <= 0 {
+		return fmt.Errorf("server.body_limit must be positive")
+	}
+	if cfg.DrainDelay < 0 {
+		return fmt.Errorf("server.drain_delay must not be negative")
+	}
+	return nil
+}
+
+// drainOnShutdown returns the context that stops the server. Once ctx is
+// done, draining is set so new webhook requests are rejected while
+// in-flight ones finish, and the returned context ends after delay.
+func drainOnShutdown(ctx context.Context, draining *atomic.Bool, delay time.Duration, logger *slog.Logger) context.Context {
+	shutdown, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-ctx.Done()
+		draining.Store(true)
+		logger.Info("draining", "drain_delay", delay.String())
+		time.Sleep(delay)
+		cancel()
+	}()
+	return shutdown
+}
+
+// rejectWhileDraining answers requests that arrive after shutdown started
+// with rejection instead of accepting work that may be cut off.
+func rejectWhileDraining(draining *atomic.Bool, rejection RejectionResponse, logger *slog.Logger) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if draining.Load() {
+			return rejection.reject(c, logger, "draining", nil)
+		}
+		return c.Next()
+	}
+}
+
+// requireContentLength answers requests whose body has no Content-Length,
+// such as Transfer-Encoding: chunked ones, with 411 when enabled. Chunked
+// bodies are otherwise read in full and held to body_limit like any other.
+func requireContentLength(logger *slog.Logger) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		// fasthttp reports -1 for chunked bodies. A request without either
+		// header has no body, which is fine.
+		if c.Request().Header.ContentLength() != -1 {
+			return c.Next()
+		}
+		logRejection(logger, c, "length required", fiber.StatusLengthRequired, nil)
+		return c.Status(fiber.StatusLengthRequired).JSON(fiber.Map{"error": "content length required"})
+	}
+}
+
+// listenAddress joins bind_address and port into a listen address and
+// picks the matching network. An empty bind address listens on all IPv4
+// interfaces, as before bind_address existed; IPv6 addresses, with or
+// without brackets, listen on IPv6 only.
+func listenAddress(bind string, port int) (addr, network string) {
+	host := strings.TrimSuffix(strings.TrimPrefix(bind, "["), "]")
+	network = fiber.NetworkTCP4
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		network = fiber.NetworkTCP6
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), network
+}
+
+// listenFDsStart is the first file descriptor systemd passes to a
+// socket-activated service.
+const listenFDsStart = 3
+
+// activationListener returns the listener systemd passed through socket
+// activation, or nil when the process was not socket-activated. Only the
+// first socket is used. The LISTEN_* variables are cleared so child
+// processes, such as an exec sink, do not try to claim it too.
+func activationListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	f := os.NewFile(uintptr(listenFDsStart), "LISTEN_FD_3")
+	ln, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+	return ln, nil
+}
+
+func newFiberConfig(cfg ServerConfig, rejections RejectionsConfig, logger *slog.Logger) fiber.Config {
+	return fiber.Config{
+		ErrorHandler:    rejectionErrorHandler(rejections, logger),
+		ServerHeader:    cfg.ServerHeader,
+		AppName:         cfg.AppName,
+		Concurrency:     cfg.Concurrency,
+		ReadBufferSize:  cfg.ReadBufferSize,
+		WriteBufferSize: cfg.WriteBufferSize,
+		BodyLimit:       cfg.BodyLimit,
+		StrictRouting:   cfg.StrictRouting,
+		CaseSensitive:   cfg.CaseSensitive,
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// newChunkedRequest returns a POST to url whose body is sent with
+// Transfer-Encoding: chunked.
+func newChunkedRequest(t *testing.T, url string, parts ...string) *http.Request {
+	t.Helper()
+	readers := make([]io.Reader, len(parts))
+	for i, p := range parts {
+		readers[i] = strings.NewReader(p)
+	}
+	// A body of unknown length makes the client send it chunked.
+	req, err := http.NewRequest(http.MethodPost, url, io.MultiReader(readers...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.TransferEncoding = []string{"chunked"}
+	return req
+}
+
+// startServerTestApp serves "/" on a local port, through
+// requireContentLength when require is set, and echoes the request body.
+// It returns the URL of "/". A real listener is used rather than
+// app.Test, which fails outright on bodies over body_limit.
+func startServerTestApp(t *testing.T, cfg ServerConfig, require bool) string {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app := fiber.New(newFiberConfig(cfg, defaultRejectionsConfig(), logger))
+	handlers := []any{func(c fiber.Ctx) error { return c.Send(c.Body()) }}
+	if require {
+		handlers = append([]any{requireContentLength(logger)}, handlers...)
+	}
+	app.All("/", handlers[0], handlers[1:]...)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+	return "http://" + ln.Addr().String() + "/"
+}
+
+// do sends req and returns the response status and body.
+func do(t *testing.T, req *http.Request) (int, []byte) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestChunkedBodyReadInFull(t *testing.T) {
+	url := startServerTestApp(t, defaultServerConfig(), false)
+	parts := []string{`{"event":`, `"` + strings.Repeat("x", 100000) + `"`, `}`}
+
+	status, got := do(t, newChunkedRequest(t, url, parts...))
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if want := strings.Join(parts, ""); string(got) != want {
+		t.Fatalf("handler saw %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestChunkedBodyLimit(t *testing.T) {
+	cfg := defaultServerConfig()
+	cfg.BodyLimit = 1024
+	url := startServerTestApp(t, cfg, false)
+
+	// Every chunk is under the limit, but their total is not.
+	status, _ := do(t, newChunkedRequest(t, url, strings.Repeat("a", 600), strings.Repeat("b", 600)))
+	if want := defaultRejectionsConfig().BodySize.Status; status != want {
+		t.Fatalf("status = %d, want %d", status, want)
+	}
+}
+
+func TestRequireContentLength(t *testing.T) {
+	url := startServerTestApp(t, defaultServerConfig(), true)
+	sized := func(method string, body io.Reader) *http.Request {
+		req, err := http.NewRequest(method, url, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{name: "chunked", req: newChunkedRequest(t, url, `{"a":`, `1}`), want: fiber.StatusLengthRequired},
+		{name: "content length", req: sized(http.MethodPost, strings.NewReader(`{"a":1}`)), want: fiber.StatusOK},
+		{name: "no body", req: sized(http.MethodGet, nil), want: fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := do(t, tt.req); status != tt.want {
+				t.Fatalf("status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
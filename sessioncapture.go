@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// sessionCaptureSink keeps every record in memory and writes them to one
+// pretty-printed JSON array file on shutdown. It is meant for small test
+// captures: memory grows with the session, so records beyond maxRecords
+// are dropped.
+type sessionCaptureSink struct {
+	mu         sync.Mutex
+	path       string
+	maxRecords int
+	logger     *slog.Logger
+	records    [][]byte
+	dropped    int
+}
+
+func newSessionCaptureSink(cfg OutputConfig, logger *slog.Logger) *sessionCaptureSink {
+	return &sessionCaptureSink{path: cfg.Path, maxRecords: cfg.MaxRecords, logger: logger}
+}
+
+// Preflight checks that the capture file's directory is writable, so a
+// bad path is noticed before the session rather than at its end.
+func (s *sessionCaptureSink) Preflight() error {
+	if err := checkDirWritable(filepath.Dir(s.path)); err != nil {
+		return fmt.Errorf("session capture dir: %w", err)
+	}
+	return nil
+}
+
+func (s *sessionCaptureSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.records) >= s.maxRecords {
+		if s.dropped == 0 {
+			s.logger.Warn("session capture full, dropping records", "max_records", s.maxRecords)
+		}
+		s.dropped++
+		return nil
+	}
+	// The caller may reuse line after Write returns.
+	s.records = append(s.records, bytes.Clone(bytes.TrimRight(line, "\n")))
+	return nil
+}
+
+// Close writes the captured records as a JSON array. The file is replaced
+// atomically, so an interrupted write never leaves a truncated array.
+func (s *sessionCaptureSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, record := range s.records {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n  ")
+		if err := json.Indent(&buf, record, "  ", "  "); err != nil {
+			return fmt.Errorf("session capture record %d: %w", i, err)
+		}
+	}
+	if len(s.records) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]\n")
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write session capture: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return errors.Join(fmt.Errorf("write session capture: %w", err), os.Remove(tmp))
+	}
+	s.logger.Info("wrote session capture", "path", s.path, "records", len(s.records), "dropped", s.dropped)
+	return nil
+}
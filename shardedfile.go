@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// shardedFileSink appends records as JSON lines to files whose path is
+// templated from each record, e.g. "logs/{{ body.repository.name }}.ndjson".
+// Open files are kept in an LRU list bounded by max_open_files, and files
+// unused for idle_timeout are closed.
+type shardedFileSink struct {
+	mu      sync.Mutex
+	path    outputTemplate
+	maxOpen int
+	idle    time.Duration
+	lru     *list.List // of *shardFile, most recently used first
+	files   map[string]*list.Element
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+type shardFile struct {
+	path     string
+	file     *os.File
+	lastUsed time.Time
+}
+
+func newShardedFileSink(cfg OutputConfig) (*shardedFileSink, error) {
+	path, err := parseOutputTemplate(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("output.path: %w", err)
+	}
+	s := &shardedFileSink{
+		path:    path,
+		maxOpen: cfg.MaxOpenFiles,
+		idle:    time.Duration(cfg.IdleTimeout),
+		lru:     list.New(),
+		files:   map[string]*list.Element{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.idleLoop()
+	return s, nil
+}
+
+// Preflight checks that the directory before the first placeholder of the
+// path template is writable; deeper templated directories are created
+// per record.
+func (s *shardedFileSink) Preflight() error {
+	if err := checkDirWritable(filepath.Dir(s.path.literals[0])); err != nil {
+		return fmt.Errorf("sharded file dir: %w", err)
+	}
+	return nil
+}
+
+func (s *shardedFileSink) idleLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.idle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for e := s.lru.Back(); e != nil; e = s.lru.Back() {
+				if now.Sub(e.Value.(*shardFile).lastUsed) < s.idle {
+					break
+				}
+				_ = s.closeElement(e)
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *shardedFileSink) Write(line []byte) error {
+	var record any
+	if err := json.Unmarshal(line, &record); err != nil {
+		return fmt.Errorf("sharded file output: %w", err)
+	}
+	// Pretty-printed lines are compacted so every file stays NDJSON.
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, line); err != nil {
+		return err
+	}
+	compact.WriteByte('\n')
+	path := s.path.render(record, shardPathSegment)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := s.open(path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(compact.Bytes())
+	return err
+}
+
+// open returns the file for path, opening it and evicting the least
+// recently used file if needed. Callers hold s.mu.
+func (s *shardedFileSink) open(path string) (*os.File, error) {
+	if e, ok := s.files[path]; ok {
+		sf := e.Value.(*shardFile)
+		sf.lastUsed = time.Now()
+		s.lru.MoveToFront(e)
+		return sf.file, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create output dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.files[path] = s.lru.PushFront(&shardFile{path: path, file: f, lastUsed: time.Now()})
+	for s.lru.Len() > s.maxOpen {
+		if err := s.closeElement(s.lru.Back()); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (s *shardedFileSink) closeElement(e *list.Element) error {
+	sf := s.lru.Remove(e).(*shardFile)
+	delete(s.files, sf.path)
+	return sf.file.Close()
+}
+
+func (s *shardedFileSink) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for s.lru.Len() > 0 {
+		errs = append(errs, s.closeElement(s.lru.Front()))
+	}
+	return errors.Join(errs...)
+}
+
+// shardPathSegment makes a templated value safe as part of a file name:
+// anything but letters, digits, '-', '_' and '.' becomes '_', so values
+// cannot add directories or climb out with "..".
+func shardPathSegment(value string) string {
+	cleaned := []rune(value)
+	for i, r := range cleaned {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			cleaned[i] = '_'
+		}
+	}
+	segment := string(cleaned)
+	if segment == "" || segment == "." || segment == ".." {
+		return "_"
+	}
+	return segment
+}
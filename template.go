@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// outputTemplate is a string with {{ path }} placeholders that are
+// filled in from an output record, e.g. "webhooks-{{ body.repository.name }}".
+type outputTemplate struct {
+	literals []string // one more than paths; literals[i] precedes paths[i]
+	paths    []string
+}
+
+func parseOutputTemplate(s string) (outputTemplate, error) {
+	var t outputTemplate
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			t.literals = append(t.literals, s)
+			return t, nil
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			return outputTemplate{}, fmt.Errorf("unclosed {{ in template")
+		}
+		path := strings.TrimSpace(s[start+2 : start+end])
+		if err := validatePath(path); err != nil {
+			return outputTemplate{}, fmt.Errorf("template placeholder: %w", err)
+		}
+		t.literals = append(t.literals, s[:start])
+		t.paths = append(t.paths, path)
+		s = s[start+end+2:]
+	}
+}
+
+// render fills the placeholders from record, passing each value through
+// clean. Missing values render as "unknown".
+func (t outputTemplate) render(record any, clean func(string) string) string {
+	var b strings.Builder
+	for i, path := range t.paths {
+		b.WriteString(t.literals[i])
+		value := "unknown"
+		if v, ok := lookupPath(record, path); ok && v != nil {
+			value = templateValue(v)
+		}
+		b.WriteString(clean(value))
+	}
+	b.WriteString(t.literals[len(t.literals)-1])
+	return b.String()
+}
+
+func templateValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// applyParseJSON decodes JSON-encoded string values found at the mapping's
+// parse_json paths. Values that are missing or not strings are left alone;
+// strings that fail to decode are kept unless parse_json_strict is set.
+func applyParseJSON(value any, m FieldMapping) (any, error) {
+	for _, path := range m.ParseJSON {
+		err := updatePath(value, path, func(current any) (any, error) {
+			s, ok := current.(string)
+			if !ok {
+				return current, nil
+			}
+			var parsed any
+			if err := json.Unmarshal([]byte(s), &parsed); err != nil {
+				if m.ParseJSONStrict {
+					return nil, fmt.Errorf("parse_json %q: %w", path, err)
+				}
+				return current, nil
+			}
+			return parsed, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+// applyMergeQuery merges query parameters into a body object. On key
+// collisions, merge_query decides whether the body or the query value is
+// kept.
+func applyMergeQuery(value any, query map[string]string, m FieldMapping) (any, error) {
+	if m.MergeQuery == "" {
+		return value, nil
+	}
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("merge_query requires a JSON object body")
+	}
+
+	for k, v := range query {
+		if _, exists := obj[k]; exists && m.MergeQuery == MergeQueryPreferBody {
+			continue
+		}
+		obj[k] = v
+	}
+	return obj, nil
+}
+
+// applyInclude keeps only the mapping's include paths, nesting each under
+// the same keys it had in the source value. Paths that do not resolve are
+// omitted unless include_defaults provides a value for them.
+func applyInclude(value any, m FieldMapping) any {
+	if len(m.Include) == 0 {
+		return value
+	}
+
+	selected := make(map[string]any, len(m.Include))
+	for _, path := range m.Include {
+		if v, ok := lookupPath(value, path); ok {
+			setPath(selected, path, v)
+		} else if v, ok := m.IncludeDefaults[path]; ok {
+			setPath(selected, path, cloneJSON(v))
+		}
+	}
+
+	return selected
+}
+
+// applyKeys keeps only the named headers or query parameters. Header
+// names match case-insensitively, query parameter names exactly. Names
+// that were not sent are simply absent.
+func applyKeys(value any, m FieldMapping) any {
+	if len(m.Keys) == 0 {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string][]string:
+		selected := make(map[string][]string, len(m.Keys))
+		for name, values := range v {
+			for _, key := range m.Keys {
+				if strings.EqualFold(name, key) {
+					selected[name] = values
+					break
+				}
+			}
+		}
+		return selected
+	case map[string]string:
+		selected := make(map[string]string, len(m.Keys))
+		for _, key := range m.Keys {
+			if param, ok := v[key]; ok {
+				selected[key] = param
+			}
+		}
+		return selected
+	default:
+		return value
+	}
+}
+
+// applyRename renames top-level keys of object values, including header
+// and query maps. Keys that are absent are ignored.
+func applyRename(value any, renames map[string]string, policy KeyCollisionPolicy) (any, error) {
+	var err error
+	switch v := value.(type) {
+	case map[string]any:
+		err = renameKeys(v, renames, policy)
+	case map[string]string:
+		err = renameKeys(v, renames, policy)
+	case map[string][]string:
+		err = renameKeys(v, renames, policy)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// renameKeys moves keys to their new names. A new name that is already
+// taken, by a key left in place or by an earlier rename in sorted order,
+// is resolved by policy: first keeps the value already there and last
+// overwrites it.
+func renameKeys[V any](m map[string]V, renames map[string]string, policy KeyCollisionPolicy) error {
+	froms := make([]string, 0, len(renames))
+	for from := range renames {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+
+	moved := make(map[string]V, len(renames))
+	origins := make(map[string]string, len(renames))
+	for _, from := range froms {
+		v, ok := m[from]
+		if !ok {
+			continue
+		}
+		delete(m, from)
+		to := renames[from]
+		if prev, taken := origins[to]; taken {
+			switch policy {
+			case KeyCollisionFirst:
+				continue
+			case KeyCollisionLast:
+			default:
+				return fmt.Errorf("rename: keys %q and %q both rename to %q", prev, from, to)
+			}
+		}
+		moved[to] = v
+		origins[to] = from
+	}
+	for k, v := range moved {
+		if _, exists := m[k]; exists {
+			switch policy {
+			case KeyCollisionFirst:
+				continue
+			case KeyCollisionLast:
+			default:
+				return fmt.Errorf("rename: key %q renamed to %q, which already exists", origins[k], k)
+			}
+		}
+		m[k] = v
+	}
+	return nil
+}
+
+// NonStringPolicy decides what prefix and suffix do with values that are
+// not strings.
+type NonStringPolicy string
+
+const (
+	NonStringSkip  NonStringPolicy = "skip"
+	NonStringError NonStringPolicy = "error"
+)
+
+// applyAffix adds prefix and suffix to a string value. Other values are
+// left unchanged, or fail the mapping with on_non_string: error.
+func applyAffix(value any, prefix, suffix string, policy NonStringPolicy) (any, error) {
+	if prefix == "" && suffix == "" {
+		return value, nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		if policy == NonStringError {
+			return nil, fmt.Errorf("prefix/suffix: value is %T, not a string", value)
+		}
+		return value, nil
+	}
+	return prefix + s + suffix, nil
+}
+
+// coerceTypes selects which kinds of strings coerce_scalars converts.
+type coerceTypes struct {
+	bool, number bool
+}
+
+// parseCoerceTypes reads the coerce_scalars types list; an empty list
+// coerces both booleans and numbers.
+func parseCoerceTypes(names []string) (coerceTypes, error) {
+	if len(names) == 0 {
+		return coerceTypes{bool: true, number: true}, nil
+	}
+	var types coerceTypes
+	for _, name := range names {
+		switch name {
+		case "bool":
+			types.bool = true
+		case "number":
+			types.number = true
+		default:
+			return coerceTypes{}, fmt.Errorf("unsupported type %q (use bool or number)", name)
+		}
+	}
+	return types, nil
+}
+
+// numberPattern is the JSON number grammar. Strings outside it, such as
+// "007", "+1", "1e", or " 42", are left alone as ambiguous.
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// applyCoerceScalars converts strings that look like booleans or numbers
+// into those types, everywhere below each path, or in the whole value
+// when no paths are given. Header and query maps become plain objects.
+func applyCoerceScalars(value any, paths []string, types coerceTypes) (any, error) {
+	if len(paths) == 0 {
+		return coerceScalars(value, types), nil
+	}
+	for _, path := range paths {
+		err := updatePath(value, path, func(current any) (any, error) {
+			return coerceScalars(current, types), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+func coerceScalars(value any, types coerceTypes) any {
+	switch v := value.(type) {
+	case string:
+		return coerceString(v, types)
+	case map[string]any:
+		for k, item := range v {
+			v[k] = coerceScalars(item, types)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = coerceScalars(item, types)
+		}
+		return v
+	case map[string]string:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = coerceString(item, types)
+		}
+		return out
+	case map[string][]string:
+		out := make(map[string]any, len(v))
+		for k, items := range v {
+			values := make([]any, len(items))
+			for i, item := range items {
+				values[i] = coerceString(item, types)
+			}
+			out[k] = values
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// coerceString converts "true" and "false" to booleans and JSON-style
+// numbers to integers or floats. Integers too large for int64 stay
+// strings rather than losing precision.
+func coerceString(s string, types coerceTypes) any {
+	if types.bool {
+		switch s {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	}
+	if types.number && numberPattern.MatchString(s) {
+		if !strings.ContainsAny(s, ".eE") {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return n
+			}
+			return s
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// applyRedact replaces the values at paths with a placeholder. Header
+// names match case-insensitively; other values use dotted paths. Missing
+// paths are left alone.
+func applyRedact(value any, paths []string) (any, error) {
+	switch v := value.(type) {
+	case map[string][]string:
+		for name := range v {
+			for _, path := range paths {
+				if strings.EqualFold(name, path) {
+					v[name] = []string{redactedValue}
+				}
+			}
+		}
+		return v, nil
+	case map[string]string:
+		for _, path := range paths {
+			if _, ok := v[path]; ok {
+				v[path] = redactedValue
+			}
+		}
+		return v, nil
+	}
+
+	for _, path := range paths {
+		err := updatePath(value, path, func(any) (any, error) {
+			return redactedValue, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// maxRedactDepth bounds how deep redact_patterns descends into output.
+// Anything nested deeper is masked whole rather than left unscanned.
+const maxRedactDepth = 64
+
+func compileRedactPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact_patterns[%d]: %w", i, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// applyRedactPatterns masks every match of patterns in the string values
+// of output, at any depth. Object keys are left as they are. Objects and
+// arrays are rebuilt rather than edited, so value itself is left as it was.
+func applyRedactPatterns(value any, patterns []*regexp.Regexp, depth int) any {
+	if depth > maxRedactDepth {
+		return redactedValue
+	}
+	switch v := value.(type) {
+	case string:
+		return redactString(v, patterns)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = applyRedactPatterns(item, patterns, depth+1)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = applyRedactPatterns(item, patterns, depth+1)
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]string, len(v))
+		for k, item := range v {
+			out[k] = redactString(item, patterns)
+		}
+		return out
+	case map[string][]string:
+		out := make(map[string][]string, len(v))
+		for k, items := range v {
+			redacted := make([]string, len(items))
+			for i, item := range items {
+				redacted[i] = redactString(item, patterns)
+			}
+			out[k] = redacted
+		}
+		return out
+	}
+	return value
+}
+
+func redactString(s string, patterns []*regexp.Regexp) string {
+	for _, re := range patterns {
+		s = re.ReplaceAllLiteralString(s, redactedValue)
+	}
+	return s
+}
+
+// truncationPlaceholder in truncation_marker is replaced with the number
+// of bytes cut from the value.
+const truncationPlaceholder = "{n}"
+
+// stringTruncator cuts string values longer than limit bytes and appends
+// marker. A zero limit leaves values alone.
+type stringTruncator struct {
+	limit  int
+	marker string
+}
+
+// apply truncates every string value of output, at any depth, including
+// header and query values. Object keys are left as they are, as is
+// anything nested deeper than maxRedactDepth. Like applyRedactPatterns,
+// it returns new objects and arrays and leaves value untouched.
+func (t stringTruncator) apply(value any, depth int) any {
+	if t.limit == 0 || depth > maxRedactDepth {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		return t.truncate(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = t.apply(item, depth+1)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = t.apply(item, depth+1)
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]string, len(v))
+		for k, item := range v {
+			out[k] = t.truncate(item)
+		}
+		return out
+	case map[string][]string:
+		out := make(map[string][]string, len(v))
+		for k, items := range v {
+			truncated := make([]string, len(items))
+			for i, item := range items {
+				truncated[i] = t.truncate(item)
+			}
+			out[k] = truncated
+		}
+		return out
+	}
+	return value
+}
+
+// truncate keeps at most limit bytes of s, backing off to a rune boundary
+// so the result stays valid UTF-8.
+func (t stringTruncator) truncate(s string) string {
+	if len(s) <= t.limit {
+		return s
+	}
+	n := t.limit
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + strings.ReplaceAll(t.marker, truncationPlaceholder, strconv.Itoa(len(s)-n))
+}
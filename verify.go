@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type MetaVerifyConfig struct {
+	VerifyToken string `json:"verify_token" yaml:"verify_token"`
+}
+
+// handleMetaVerify answers the Meta/Facebook subscription handshake: a GET
+// with hub.mode=subscribe whose hub.verify_token matches the configured
+// token gets hub.challenge echoed back as plain text. It reports whether
+// the request was a handshake so the caller can skip the normal pipeline.
+func handleMetaVerify(c fiber.Ctx, cfg MetaVerifyConfig, logger *slog.Logger) (bool, error) {
+	if cfg.VerifyToken == "" || c.Method() != fiber.MethodGet || c.Query("hub.mode") != "subscribe" {
+		return false, nil
+	}
+
+	token := c.Query("hub.verify_token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.VerifyToken)) != 1 {
+		logRejection(logger, c, "meta verify token", fiber.StatusForbidden, nil)
+		return true, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "verify token mismatch"})
+	}
+
+	return true, c.Status(fiber.StatusOK).SendString(c.Query("hub.challenge"))
+}
+
+type SlackVerifyConfig struct {
+	SigningSecret string   `json:"signing_secret" yaml:"signing_secret"`
+	Tolerance     Duration `json:"tolerance" yaml:"tolerance"`
+}
+
+// verifySlack checks a Slack request signature: X-Slack-Signature must be
+// "v0=" followed by the hex HMAC-SHA256 of "v0:{timestamp}:{body}" keyed
+// with the signing secret, and X-Slack-Request-Timestamp must be within
+// the tolerance window of now to prevent replays.
+func verifySlack(c fiber.Ctx, body []byte, cfg SlackVerifyConfig, now time.Time) error {
+	timestamp := c.Get("X-Slack-Request-Timestamp")
+	if timestamp == "" {
+		return errors.New("missing X-Slack-Request-Timestamp header")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid X-Slack-Request-Timestamp header: %w", err)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)).Abs(); age > time.Duration(cfg.Tolerance) {
+		return fmt.Errorf("request timestamp outside tolerance of %s", time.Duration(cfg.Tolerance))
+	}
+
+	signature, ok := strings.CutPrefix(c.Get("X-Slack-Signature"), "v0=")
+	if !ok {
+		return errors.New("missing or malformed X-Slack-Signature header")
+	}
+	provided, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("missing or malformed X-Slack-Signature header")
+	}
+
+	mac := hmac.New(sha256.New, []byte(cfg.SigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	if !hmac.Equal(provided, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+type GitHubVerifyConfig struct {
+	Secret string `json:"secret" yaml:"secret"`
+}
+
+// verifyGitHub checks X-Hub-Signature-256, which GitHub sets to "sha256="
+// followed by the hex HMAC-SHA256 of the raw body keyed with the webhook
+// secret.
+func verifyGitHub(c fiber.Ctx, body []byte, cfg GitHubVerifyConfig) error {
+	signature, ok := strings.CutPrefix(c.Get("X-Hub-Signature-256"), "sha256=")
+	if !ok {
+		return errors.New("missing or malformed X-Hub-Signature-256 header")
+	}
+	provided, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("missing or malformed X-Hub-Signature-256 header")
+	}
+
+	mac := hmac.New(sha256.New, []byte(cfg.Secret))
+	mac.Write(body)
+	if !hmac.Equal(provided, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// verifyRequest runs every signature check configured for the route
+// against the raw body and reports which one failed, if any.
+func verifyRequest(c fiber.Ctx, body []byte, cfg Config, route RouteConfig, now time.Time) (string, error) {
+	if route.SlackVerify.SigningSecret != "" {
+		if err := verifySlack(c, body, *route.SlackVerify, now); err != nil {
+			return "slack signature", err
+		}
+	}
+	if route.GitHubVerify.Secret != "" {
+		if err := verifyGitHub(c, body, *route.GitHubVerify); err != nil {
+			return "github signature", err
+		}
+	}
+	if err := readJWT(c, cfg.JWT, now); err != nil {
+		return "jwt", err
+	}
+	return "", nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+)
+
+// The secret, body, and signature are the test vector from GitHub's
+// webhook validation docs.
+const (
+	githubTestSecret    = "It's a Secret to Everybody"
+	githubTestBody      = "Hello, World!"
+	githubTestSignature = "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+)
+
+func TestVerifyGitHub(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		wantErr   string
+	}{
+		{name: "valid", body: githubTestBody, signature: githubTestSignature},
+		{name: "tampered body", body: "Hello, World?", signature: githubTestSignature, wantErr: "signature mismatch"},
+		{name: "missing header", body: githubTestBody, wantErr: "missing or malformed X-Hub-Signature-256 header"},
+		{name: "missing prefix", body: githubTestBody, signature: githubTestSignature[len("sha256="):], wantErr: "missing or malformed X-Hub-Signature-256 header"},
+		{name: "sha1 prefix", body: githubTestBody, signature: "sha1=" + githubTestSignature[len("sha256="):], wantErr: "missing or malformed X-Hub-Signature-256 header"},
+		{name: "not hex", body: githubTestBody, signature: "sha256=not-hex", wantErr: "missing or malformed X-Hub-Signature-256 header"},
+	}
+
+	app := fiber.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := app.AcquireCtx(&fasthttp.RequestCtx{})
+			defer app.ReleaseCtx(c)
+			if tt.signature != "" {
+				c.Request().Header.Set("X-Hub-Signature-256", tt.signature)
+			}
+
+			err := verifyGitHub(c, []byte(tt.body), GitHubVerifyConfig{Secret: githubTestSecret})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("verifyGitHub() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("verifyGitHub() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// The secret, timestamp, body, and signature are the example from Slack's
+// request verification docs.
+const (
+	slackTestSecret    = "8f742231b10e8888abcd99yyyzzz85a5"
+	slackTestTimestamp = "1531420618"
+	slackTestBody      = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	slackTestSignature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+)
+
+func TestVerifySlack(t *testing.T) {
+	signedAt := time.Unix(1531420618, 0)
+	tests := []struct {
+		name      string
+		body      string
+		timestamp string
+		signature string
+		now       time.Time
+		wantErr   string
+	}{
+		{name: "valid", body: slackTestBody, timestamp: slackTestTimestamp, signature: slackTestSignature, now: signedAt},
+		{name: "within tolerance", body: slackTestBody, timestamp: slackTestTimestamp, signature: slackTestSignature, now: signedAt.Add(4 * time.Minute)},
+		{name: "tampered body", body: slackTestBody + "&x=1", timestamp: slackTestTimestamp, signature: slackTestSignature, now: signedAt, wantErr: "signature mismatch"},
+		{name: "stale timestamp", body: slackTestBody, timestamp: slackTestTimestamp, signature: slackTestSignature, now: signedAt.Add(6 * time.Minute), wantErr: "request timestamp outside tolerance of 5m0s"},
+		{name: "future timestamp", body: slackTestBody, timestamp: slackTestTimestamp, signature: slackTestSignature, now: signedAt.Add(-6 * time.Minute), wantErr: "request timestamp outside tolerance of 5m0s"},
+		{name: "missing timestamp", body: slackTestBody, signature: slackTestSignature, now: signedAt, wantErr: "missing X-Slack-Request-Timestamp header"},
+		{name: "non-numeric timestamp", body: slackTestBody, timestamp: "yesterday", signature: slackTestSignature, now: signedAt, wantErr: `invalid X-Slack-Request-Timestamp header: strconv.ParseInt: parsing "yesterday": invalid syntax`},
+		{name: "missing signature", body: slackTestBody, timestamp: slackTestTimestamp, now: signedAt, wantErr: "missing or malformed X-Slack-Signature header"},
+		{name: "missing prefix", body: slackTestBody, timestamp: slackTestTimestamp, signature: strings.TrimPrefix(slackTestSignature, "v0="), now: signedAt, wantErr: "missing or malformed X-Slack-Signature header"},
+		{name: "wrong version prefix", body: slackTestBody, timestamp: slackTestTimestamp, signature: "v1=" + strings.TrimPrefix(slackTestSignature, "v0="), now: signedAt, wantErr: "missing or malformed X-Slack-Signature header"},
+		{name: "not hex", body: slackTestBody, timestamp: slackTestTimestamp, signature: "v0=not-hex", now: signedAt, wantErr: "missing or malformed X-Slack-Signature header"},
+	}
+
+	cfg := SlackVerifyConfig{SigningSecret: slackTestSecret, Tolerance: Duration(5 * time.Minute)}
+	app := fiber.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := app.AcquireCtx(&fasthttp.RequestCtx{})
+			defer app.ReleaseCtx(c)
+			if tt.timestamp != "" {
+				c.Request().Header.Set("X-Slack-Request-Timestamp", tt.timestamp)
+			}
+			if tt.signature != "" {
+				c.Request().Header.Set("X-Slack-Signature", tt.signature)
+			}
+
+			err := verifySlack(c, []byte(tt.body), cfg, tt.now)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("verifySlack() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("verifySlack() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}